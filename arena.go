@@ -0,0 +1,329 @@
+package cache
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+)
+
+// entryHeaderSize is the size of an arena entry before its key: the entry
+// length, the key hash and the key length.
+const entryHeaderSize = 4 + 8 + 2
+
+// maxArenaSize is the most bytes an arena can address with its 32 bit
+// offsets.
+const maxArenaSize = 1 << 32
+
+// NewArenaDataHandler returns a DataHandler that serializes items into
+// chunks preallocated chunks of chunkSize bytes used as a ring buffer, so
+// the garbage collector sees a handful of large byte slices instead of a
+// pointer per item. []byte values are stored as is, any other value is
+// encoded with codec, a nil codec uses GobCodec. Entries use the format
+// written by EncodeValue.
+//
+// Keys are indexed by a 64 bit hash, keys whose hashes collide are kept
+// side by side. Every Put appends an entry, the cache puts an item back on
+// each Get to record the access. Once the ring is full the oldest chunk is
+// compacted, keeping its live entries and reusing the room left by
+// overwritten and removed ones. Put returns an error when every chunk is
+// full of live entries, nothing is ever dropped. chunkSize < 1 defaults to
+// 1MiB and chunks < 1 to 64. Entries are addressed with 32 bit offsets, so
+// chunkSize is capped at 4GiB and chunks is lowered until chunkSize times
+// chunks fits in 4GiB.
+func NewArenaDataHandler(chunkSize, chunks int, codec Codec) LenDataHandler {
+	chunkSize, chunks = arenaSize(chunkSize, chunks)
+	if codec == nil {
+		codec = GobCodec{}
+	}
+	toRet := &arena{
+		chunks:   make([][]byte, chunks),
+		used:     make([]int, chunks),
+		index:    make(map[uint64]uint32),
+		collided: make(map[uint64][]uint32),
+		hash:     hashKey,
+		codec:    codec,
+	}
+	for i := range toRet.chunks {
+		toRet.chunks[i] = make([]byte, chunkSize)
+	}
+	return toRet
+}
+
+// arenaSize applies the defaults and limits of NewArenaDataHandler to
+// chunkSize and chunks.
+func arenaSize(chunkSize, chunks int) (int, int) {
+	size, count := int64(chunkSize), int64(chunks)
+	if size < 1 {
+		size = 1 << 20
+	}
+	if size > maxArenaSize {
+		size = maxArenaSize
+	}
+	if count < 1 {
+		count = 64
+	}
+	if size*count > maxArenaSize {
+		count = maxArenaSize / size
+	}
+	return int(size), int(count)
+}
+
+type arena struct {
+	sync.RWMutex
+	chunks [][]byte
+	// used is how many bytes of each chunk hold entries.
+	used []int
+	// cur is the chunk being written to.
+	cur int
+	// index maps a key's hash to the offset of its entry, chunk number
+	// times chunk size plus the position in the chunk. collided holds the
+	// offsets of the other keys with the same hash, if any.
+	index    map[uint64]uint32
+	collided map[uint64][]uint32
+	// hash is hashKey, swapped out in tests to force collisions.
+	hash  func(string) uint64
+	codec Codec
+}
+
+// hashKey hashes key with 64 bit FNV-1a.
+func hashKey(key string) uint64 {
+	hash := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint64(key[i])
+		hash *= 1099511628211
+	}
+	return hash
+}
+
+// entry returns the key and encoded value of the entry at offset.
+func (a *arena) entry(offset uint32) (string, []byte) {
+	chunkSize := uint32(len(a.chunks[0]))
+	chunk := a.chunks[offset/chunkSize]
+	pos := offset % chunkSize
+	size := binary.BigEndian.Uint32(chunk[pos:])
+	keyLen := uint32(binary.BigEndian.Uint16(chunk[pos+12:]))
+	ent := chunk[pos : pos+size]
+	return string(ent[entryHeaderSize : entryHeaderSize+keyLen]), ent[entryHeaderSize+keyLen:]
+}
+
+// locate returns the offset of the entry for key.
+func (a *arena) locate(key string, hash uint64) (uint32, bool) {
+	offset, ok := a.index[hash]
+	if !ok {
+		return 0, false
+	}
+	if stored, _ := a.entry(offset); stored == key {
+		return offset, true
+	}
+	for _, offset := range a.collided[hash] {
+		if stored, _ := a.entry(offset); stored == key {
+			return offset, true
+		}
+	}
+	return 0, false
+}
+
+// link indexes a new entry at offset.
+func (a *arena) link(hash uint64, offset uint32) {
+	if _, ok := a.index[hash]; ok {
+		a.collided[hash] = append(a.collided[hash], offset)
+		return
+	}
+	a.index[hash] = offset
+}
+
+// relink points the index at to instead of from, it reports false if
+// nothing was indexed at from.
+func (a *arena) relink(hash uint64, from, to uint32) bool {
+	if offset, ok := a.index[hash]; ok && offset == from {
+		a.index[hash] = to
+		return true
+	}
+	for i, offset := range a.collided[hash] {
+		if offset == from {
+			a.collided[hash][i] = to
+			return true
+		}
+	}
+	return false
+}
+
+// unlink drops the entry at offset from the index.
+func (a *arena) unlink(hash uint64, offset uint32) {
+	others := a.collided[hash]
+	if a.index[hash] == offset {
+		if len(others) == 0 {
+			delete(a.index, hash)
+			return
+		}
+		a.index[hash] = others[len(others)-1]
+		others = others[:len(others)-1]
+	} else {
+		for i := range others {
+			if others[i] == offset {
+				others = append(others[:i], others[i+1:]...)
+				break
+			}
+		}
+	}
+	if len(others) == 0 {
+		delete(a.collided, hash)
+		return
+	}
+	a.collided[hash] = others
+}
+
+func (a *arena) Put(key string, data interface{}) error {
+	val, err := EncodeValue(a.codec, data)
+	if err != nil {
+		return err
+	}
+	chunkSize := len(a.chunks[0])
+	size := entryHeaderSize + len(key) + len(val)
+	if size > chunkSize || len(key) > 0xffff {
+		return fmt.Errorf("%s needs %d bytes, more than the arena chunk size of %d", key, size, chunkSize)
+	}
+	hash := a.hash(key)
+
+	a.Lock()
+	defer a.Unlock()
+	if a.used[a.cur]+size > chunkSize && !a.advance(size) {
+		return fmt.Errorf("%s needs %d bytes, the arena is full of live entries", key, size)
+	}
+	pos := a.used[a.cur]
+	chunk := a.chunks[a.cur]
+	binary.BigEndian.PutUint32(chunk[pos:], uint32(size))
+	binary.BigEndian.PutUint64(chunk[pos+4:], hash)
+	binary.BigEndian.PutUint16(chunk[pos+12:], uint16(len(key)))
+	copy(chunk[pos+entryHeaderSize:], key)
+	copy(chunk[pos+entryHeaderSize+len(key):], val)
+	a.used[a.cur] = pos + size
+	offset := uint32(a.cur*chunkSize + pos)
+	if old, ok := a.locate(key, hash); ok {
+		a.relink(hash, old, offset)
+	} else {
+		a.link(hash, offset)
+	}
+	return nil
+}
+
+// advance moves on to the next chunk with room for size bytes, compacting
+// each chunk it visits. It returns false after going round the whole ring
+// without finding room.
+func (a *arena) advance(size int) bool {
+	for range a.chunks {
+		a.cur = (a.cur + 1) % len(a.chunks)
+		a.compact(a.cur)
+		if a.used[a.cur]+size <= len(a.chunks[a.cur]) {
+			return true
+		}
+	}
+	return false
+}
+
+// compact moves the entries still indexed in chunk i to its start, dropping
+// the ones that were overwritten or removed.
+func (a *arena) compact(i int) {
+	chunk := a.chunks[i]
+	base := uint32(i * len(chunk))
+	end := 0
+	for pos := 0; pos < a.used[i]; {
+		size := int(binary.BigEndian.Uint32(chunk[pos:]))
+		hash := binary.BigEndian.Uint64(chunk[pos+4:])
+		if a.relink(hash, base+uint32(pos), base+uint32(end)) {
+			copy(chunk[end:], chunk[pos:pos+size])
+			end += size
+		}
+		pos += size
+	}
+	a.used[i] = end
+}
+
+func (a *arena) Get(key string) (interface{}, error) {
+	a.RLock()
+	offset, ok := a.locate(key, a.hash(key))
+	var val []byte
+	if ok {
+		_, val = a.entry(offset)
+		// decoding happens outside the lock, the chunk may be reused
+		val = append([]byte(nil), val...)
+	}
+	a.RUnlock()
+	if !ok {
+		return nil, ValueNotPresentError{
+			Key: key,
+		}
+	}
+	return DecodeValue(a.codec, val)
+}
+
+func (a *arena) Clear() error {
+	a.Lock()
+	for i := range a.used {
+		a.used[i] = 0
+	}
+	a.cur = 0
+	a.index = make(map[uint64]uint32)
+	a.collided = make(map[uint64][]uint32)
+	a.Unlock()
+	return nil
+}
+
+func (a *arena) Remove(key string) error {
+	hash := a.hash(key)
+	a.Lock()
+	defer a.Unlock()
+	offset, ok := a.locate(key, hash)
+	if !ok {
+		return ValueNotPresentError{
+			Key: key,
+		}
+	}
+	a.unlink(hash, offset)
+	return nil
+}
+
+// Range copies the entries before decoding them and calling f, so f is free
+// to modify the cache. Entries that cannot be decoded are skipped.
+func (a *arena) Range(f func(string, interface{}) bool) {
+	type item struct {
+		key string
+		val []byte
+	}
+	a.RLock()
+	items := make([]item, 0, a.len())
+	add := func(offset uint32) {
+		key, val := a.entry(offset)
+		items = append(items, item{key, append([]byte(nil), val...)})
+	}
+	for hash, offset := range a.index {
+		add(offset)
+		for _, offset := range a.collided[hash] {
+			add(offset)
+		}
+	}
+	a.RUnlock()
+	for _, i := range items {
+		val, err := DecodeValue(a.codec, i.val)
+		if err != nil {
+			continue
+		}
+		if !f(i.key, val) {
+			return
+		}
+	}
+}
+
+func (a *arena) Len() int {
+	a.RLock()
+	defer a.RUnlock()
+	return a.len()
+}
+
+func (a *arena) len() int {
+	toRet := len(a.index)
+	for _, others := range a.collided {
+		toRet += len(others)
+	}
+	return toRet
+}
@@ -0,0 +1,178 @@
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestArenaDataHandler(t *testing.T) {
+	t.Run("Cacher", func(t *testing.T) {
+		handler := NewArenaDataHandler(4096, 4, nil)
+		myCache := NewCache(handler, NewTimedInvalidator(time.Hour))
+		defer myCache.Destroy()
+		for i := 0; i < 50; i++ {
+			myCache.Put(fmt.Sprintf("foo%d", i), i)
+		}
+		myCache.Put("bytes", []byte("bar"))
+		myCache.PutWithTTL("ttl", "baz", time.Hour)
+		if handler.Len() != 52 {
+			t.Errorf("Len() expected %d, got %d", 52, handler.Len())
+		}
+		for i := 0; i < 50; i++ {
+			if found, err := myCache.Get(fmt.Sprintf("foo%d", i)); err != nil || found != i {
+				t.Errorf("Cacher.Get() expected %d, got '%#v', '%v'", i, found, err)
+			}
+		}
+		if found, err := myCache.Get("bytes"); err != nil || !bytes.Equal(found.([]byte), []byte("bar")) {
+			t.Errorf("Cacher.Get() expected 'bar', got '%#v', '%v'", found, err)
+		}
+		stored, err := handler.Get("ttl")
+		if err != nil {
+			t.Fatalf("Get() returned an error, %v", err)
+		}
+		elem := stored.(cacheElement)
+		if elem.Value() != "baz" || elem.Metadata().Expires == 0 || elem.Metadata().Created == 0 {
+			t.Errorf("Get() lost the element's metadata, got %v", elem.Metadata())
+		}
+		myCache.Remove("foo0")
+		if _, err := handler.Get("foo0"); !IsValueNotPresentError(err) {
+			t.Errorf("Get() should have returned a ValueNotPresentError, got '%v'", err)
+		}
+	})
+
+	t.Run("Wrap", func(t *testing.T) {
+		// 3 chunks with room for 4 entries each
+		handler := NewArenaDataHandler(4*(entryHeaderSize+5+2+10), 3, nil)
+		for i := 0; i < 12; i++ {
+			if err := handler.Put(fmt.Sprintf("foo%02d", i), []byte("0123456789")); err != nil {
+				t.Fatalf("Put() returned an error, %v", err)
+			}
+		}
+		if handler.Len() != 12 {
+			t.Errorf("Len() expected %d, got %d", 12, handler.Len())
+		}
+		// every entry is live, there is no room left
+		if err := handler.Put("foo12", []byte("0123456789")); err == nil {
+			t.Errorf("Put() should have failed on an arena full of live entries")
+		}
+		// removing foo05 leaves a dead entry in the second chunk, the
+		// next Put compacts it away and keeps every live entry
+		handler.Remove("foo05")
+		if err := handler.Put("foo12", []byte("0123456789")); err != nil {
+			t.Fatalf("Put() returned an error, %v", err)
+		}
+		if handler.Len() != 12 {
+			t.Errorf("Len() expected %d, got %d", 12, handler.Len())
+		}
+		for i := 0; i < 13; i++ {
+			found, err := handler.Get(fmt.Sprintf("foo%02d", i))
+			if i == 5 {
+				if !IsValueNotPresentError(err) {
+					t.Errorf("Get() should have returned a ValueNotPresentError, got '%v'", err)
+				}
+				continue
+			}
+			if err != nil || string(found.([]byte)) != "0123456789" {
+				t.Errorf("Get() expected '0123456789' for foo%02d, got '%#v', '%v'", i, found, err)
+			}
+		}
+		if err := handler.Put("big", make([]byte, 1000)); err == nil {
+			t.Errorf("Put() should have rejected an entry larger than a chunk")
+		}
+	})
+
+	t.Run("WrapOnGet", func(t *testing.T) {
+		handler := NewArenaDataHandler(4096, 4, nil)
+		myCache := NewCache(handler, nil, WithMaxEntries(20))
+		defer myCache.Destroy()
+		for i := 0; i < 20; i++ {
+			myCache.Put(fmt.Sprintf("foo%d", i), i)
+		}
+		// every Get writes the item back, wrapping the ring many times
+		for i := 0; i < 500; i++ {
+			myCache.Get("foo0")
+		}
+		if handler.Len() != 20 || myCache.Stats().Entries != 20 {
+			t.Errorf("Get() lost items, handler has %d, cache counts %d", handler.Len(), myCache.Stats().Entries)
+		}
+		for i := 0; i < 20; i++ {
+			if found, err := myCache.Get(fmt.Sprintf("foo%d", i)); err != nil || found != i {
+				t.Errorf("Cacher.Get() expected %d, got '%#v', '%v'", i, found, err)
+			}
+		}
+	})
+
+	t.Run("Collision", func(t *testing.T) {
+		handler := NewArenaDataHandler(4096, 2, nil)
+		// every key collides
+		handler.(*arena).hash = func(string) uint64 { return 1 }
+		for i := 0; i < 3; i++ {
+			handler.Put(fmt.Sprintf("foo%d", i), i)
+		}
+		handler.Put("foo1", "bar")
+		handler.Remove("foo0")
+		// wrap the ring so every chunk is compacted
+		for i := 0; i < 100; i++ {
+			handler.Put("foo2", i)
+		}
+		if handler.Len() != 2 {
+			t.Errorf("Len() expected %d, got %d", 2, handler.Len())
+		}
+		if _, err := handler.Get("foo0"); !IsValueNotPresentError(err) {
+			t.Errorf("Get() should have returned a ValueNotPresentError, got '%v'", err)
+		}
+		for key, val := range map[string]interface{}{"foo1": "bar", "foo2": 99} {
+			if found, err := handler.Get(key); err != nil || found != val {
+				t.Errorf("Get() expected '%v' at %s, got '%#v', '%v'", val, key, found, err)
+			}
+		}
+	})
+
+	t.Run("Size", func(t *testing.T) {
+		tests := []struct {
+			chunkSize, chunks int
+			expSize, expCount int
+		}{
+			{0, 0, 1 << 20, 64},
+			{1 << 30, 8, 1 << 30, 4},
+			{1 << 20, 1 << 20, 1 << 20, 1 << 12},
+		}
+		for _, tc := range tests {
+			size, count := arenaSize(tc.chunkSize, tc.chunks)
+			if size != tc.expSize || count != tc.expCount {
+				t.Errorf("arenaSize(%d, %d) expected %d, %d, got %d, %d",
+					tc.chunkSize, tc.chunks, tc.expSize, tc.expCount, size, count)
+			}
+		}
+	})
+
+	t.Run("Range", func(t *testing.T) {
+		handler := NewArenaDataHandler(0, 0, nil)
+		for i := 0; i < 10; i++ {
+			handler.Put(fmt.Sprintf("foo%d", i), i)
+		}
+		count := 0
+		handler.Range(func(key string, val interface{}) bool {
+			// removing from within Range must not deadlock
+			handler.Remove(key)
+			if key != fmt.Sprintf("foo%d", val) {
+				t.Errorf("Range() got %s for %v", key, val)
+			}
+			count++
+			return true
+		})
+		if count != 10 || handler.Len() != 0 {
+			t.Errorf("Range() visited %d items, %d remain", count, handler.Len())
+		}
+		handler.Put("foo", nil)
+		if found, err := handler.Get("foo"); err != nil || found != nil {
+			t.Errorf("Get() expected nil, got '%#v', '%v'", found, err)
+		}
+		handler.Clear()
+		if handler.Len() != 0 {
+			t.Errorf("Clear() left %d items", handler.Len())
+		}
+	})
+}
@@ -0,0 +1,292 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// BatchDataHandler is an optional extension of DataHandler for backends that
+// can work on many keys in one round trip. NewCache detects it with a type
+// assertion for Cacher.GetMany, Cacher.PutMany and Cacher.RemoveMany, otherwise
+// those loop over the single key methods.
+type BatchDataHandler interface {
+	DataHandler
+	// GetMany returns the items found for keys, keys with nothing in the
+	// cache are left out of the result.
+	GetMany([]string) (map[string]interface{}, error)
+	// PutMany puts every item in the cache.
+	PutMany(map[string]interface{}) error
+	// RemoveMany removes the items at keys, keys with nothing in the cache
+	// are ignored.
+	RemoveMany([]string) error
+}
+
+// TypedBatchDataHandler is the generic counterpart of BatchDataHandler,
+// detected by NewTypedCache.
+type TypedBatchDataHandler[K comparable, V any] interface {
+	TypedDataHandler[K, V]
+	// GetMany returns the items found for keys, keys with nothing in the
+	// cache are left out of the result.
+	GetMany([]K) (map[K]V, error)
+	// PutMany puts every item in the cache.
+	PutMany(map[K]V) error
+	// RemoveMany removes the items at keys, keys with nothing in the cache
+	// are ignored.
+	RemoveMany([]K) error
+}
+
+// batchHandler returns handler as a TypedBatchDataHandler, looping over
+// single key calls if it doesn't support batches itself.
+func batchHandler[K comparable, V any](
+	handler TypedDataHandler[K, V],
+) TypedBatchDataHandler[K, V] {
+	if batch, ok := handler.(TypedBatchDataHandler[K, V]); ok {
+		return batch
+	}
+	return withBatch[K, V]{handler}
+}
+
+type withBatch[K comparable, V any] struct {
+	TypedDataHandler[K, V]
+}
+
+func (w withBatch[K, V]) GetMany(keys []K) (map[K]V, error) {
+	return getMany[K, V](w.TypedDataHandler, keys)
+}
+
+func (w withBatch[K, V]) PutMany(items map[K]V) error {
+	return putMany[K, V](w.TypedDataHandler, items)
+}
+
+func (w withBatch[K, V]) RemoveMany(keys []K) error {
+	return removeMany[K, V](w.TypedDataHandler, keys)
+}
+
+func getMany[K comparable, V any](handler TypedDataHandler[K, V], keys []K) (map[K]V, error) {
+	toRet := make(map[K]V, len(keys))
+	for _, key := range keys {
+		found, err := handler.Get(key)
+		if err != nil {
+			if IsValueNotPresentError(err) {
+				continue
+			}
+			return nil, err
+		}
+		toRet[key] = found
+	}
+	return toRet, nil
+}
+
+func putMany[K comparable, V any](handler TypedDataHandler[K, V], items map[K]V) error {
+	for key, val := range items {
+		if err := handler.Put(key, val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func removeMany[K comparable, V any](handler TypedDataHandler[K, V], keys []K) error {
+	for _, key := range keys {
+		if err := handler.Remove(key); err != nil && !IsValueNotPresentError(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d dataHandlerAdapter) GetMany(keys []string) (map[string]cacheElement, error) {
+	batch, ok := d.DataHandler.(BatchDataHandler)
+	if !ok {
+		return getMany[string, cacheElement](d, keys)
+	}
+	found, err := batch.GetMany(keys)
+	if err != nil {
+		return nil, err
+	}
+	toRet := make(map[string]cacheElement, len(found))
+	for key, val := range found {
+		if toRet[key], err = unpackElement(key, val, nil); err != nil {
+			return nil, err
+		}
+	}
+	return toRet, nil
+}
+
+func (d dataHandlerAdapter) PutMany(items map[string]cacheElement) error {
+	batch, ok := d.DataHandler.(BatchDataHandler)
+	if !ok {
+		return putMany[string, cacheElement](d, items)
+	}
+	toPut := make(map[string]interface{}, len(items))
+	for key, elem := range items {
+		toPut[key] = elem
+	}
+	return batch.PutMany(toPut)
+}
+
+func (d dataHandlerAdapter) RemoveMany(keys []string) error {
+	if batch, ok := d.DataHandler.(BatchDataHandler); ok {
+		return batch.RemoveMany(keys)
+	}
+	return removeMany[string, cacheElement](d, keys)
+}
+
+func (c *cache[K, V]) GetMany(keys []K) (map[K]V, []K, error) {
+	found, missing, err := c.getManyElements(keys)
+	if err != nil && found == nil {
+		return nil, missing, err
+	}
+	toRet := make(map[K]V, len(found))
+	for key, elem := range found {
+		toRet[key] = elem.data
+	}
+	return toRet, missing, err
+}
+
+// getManyElements is GetMany returning the Metadata of the items found
+// along with their values.
+func (c *cache[K, V]) getManyElements(keys []K) (map[K]Element[V], []K, error) {
+	unlock := c.keys.lockMany(keys)
+	found, err := c.batch.GetMany(keys)
+	if err != nil {
+		unlock()
+		return nil, nil, err
+	}
+	toRet := make(map[K]Element[V], len(found))
+	var missing []K
+	accessed := make(map[K]Element[V], len(found))
+	expired := make(map[K]RemovalReason)
+	now := time.Now()
+	for _, key := range keys {
+		elem, ok := found[key]
+		if !ok {
+			missing = append(missing, key)
+			continue
+		}
+		if reason, isExpired := c.expiry(&elem.metadata, now); isExpired {
+			expired[key] = reason
+			missing = append(missing, key)
+			continue
+		}
+		c.accessed(key, &elem.metadata, now)
+		c.reaper.Access(&elem.metadata)
+		if c.expiring != nil {
+			c.expiries.schedule(key, c.deadline(&elem.metadata))
+		}
+		c.lru.touch(key)
+		accessed[key] = elem
+		toRet[key] = elem
+	}
+	atomic.AddInt64(&c.stats.hits, int64(len(toRet)))
+	atomic.AddInt64(&c.stats.misses, int64(len(missing)))
+	var gone []removal[K, V]
+	if len(expired) > 0 {
+		toRemove := make([]K, 0, len(expired))
+		for key := range expired {
+			toRemove = append(toRemove, key)
+		}
+		if c.batch.RemoveMany(toRemove) == nil {
+			for key, reason := range expired {
+				c.forget(key, reason)
+				gone = append(gone, removal[K, V]{key, found[key].data, reason})
+			}
+		}
+	}
+	if len(accessed) > 0 {
+		err = c.batch.PutMany(accessed)
+	}
+	unlock()
+	c.removals.notifyAll(gone)
+	return toRet, missing, err
+}
+
+func (c *cache[K, V]) PutMany(items map[K]V) error {
+	costs := make(map[K]int64, len(items))
+	keys := make([]K, 0, len(items))
+	for key, val := range items {
+		cost, err := c.costOf(key, val)
+		if err != nil {
+			return err
+		}
+		costs[key] = cost
+		keys = append(keys, key)
+	}
+	unlock := c.keys.lockMany(keys)
+	found, err := c.batch.GetMany(keys)
+	if err != nil {
+		unlock()
+		return err
+	}
+	var gone []removal[K, V]
+	now := time.Now()
+	for key, elem := range found {
+		if reason, expired := c.expiry(&elem.metadata, now); expired {
+			// the put below overwrites what is left in the DataHandler
+			c.forget(key, reason)
+			gone = append(gone, removal[K, V]{key, elem.data, reason})
+			delete(found, key)
+		}
+	}
+	toPut := make(map[K]Element[V], len(items))
+	for key, val := range items {
+		elem, ok := found[key]
+		elem.metadata.setLifetime(lifetime{})
+		if ok {
+			c.reaper.Update(&elem.metadata)
+		} else {
+			c.reaper.Create(&elem.metadata)
+			c.negatives.remove(key)
+		}
+		elem.data = val
+		toPut[key] = elem
+	}
+	if err = c.batch.PutMany(toPut); err != nil {
+		for key := range items {
+			if _, ok := found[key]; !ok {
+				c.reaper.Remove()
+			}
+		}
+		unlock()
+		c.removals.notifyAll(gone)
+		return err
+	}
+	atomic.AddInt64(&c.stats.puts, int64(len(items)))
+	atomic.AddInt64(&c.stats.overwrites, int64(len(found)))
+	for key, elem := range toPut {
+		c.expiries.schedule(key, c.deadline(&elem.metadata))
+		c.lru.add(key, costs[key])
+		if elem, ok := found[key]; ok {
+			gone = append(gone, removal[K, V]{key, elem.data, Replaced})
+		}
+	}
+	unlock()
+	c.removals.notifyAll(gone)
+	c.evict()
+	return nil
+}
+
+func (c *cache[K, V]) RemoveMany(keys []K) error {
+	unlock := c.keys.lockMany(keys)
+	found, err := c.batch.GetMany(keys)
+	if err != nil {
+		unlock()
+		return err
+	}
+	toRemove := make([]K, 0, len(found))
+	for key := range found {
+		toRemove = append(toRemove, key)
+	}
+	if err = c.batch.RemoveMany(toRemove); err != nil {
+		unlock()
+		return err
+	}
+	gone := make([]removal[K, V], 0, len(found))
+	for key, elem := range found {
+		c.forget(key, Removed)
+		gone = append(gone, removal[K, V]{key, elem.data, Removed})
+	}
+	unlock()
+	c.removals.notifyAll(gone)
+	return nil
+}
@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+// countingBatchHandler counts the calls made to a BatchDataHandler.
+type countingBatchHandler struct {
+	DataHandler
+	batchCalls int
+}
+
+func (c *countingBatchHandler) GetMany(keys []string) (map[string]interface{}, error) {
+	c.batchCalls++
+	return getMany[string, interface{}](c.DataHandler, keys)
+}
+
+func (c *countingBatchHandler) PutMany(items map[string]interface{}) error {
+	c.batchCalls++
+	return putMany[string, interface{}](c.DataHandler, items)
+}
+
+func (c *countingBatchHandler) RemoveMany(keys []string) error {
+	c.batchCalls++
+	return removeMany[string, interface{}](c.DataHandler, keys)
+}
+
+func TestBatch(t *testing.T) {
+	t.Run("handler=Looping", func(t *testing.T) {
+		testBatch(t, NewInMemoryDataHandler())
+	})
+	t.Run("handler=Batch", func(t *testing.T) {
+		handler := &countingBatchHandler{DataHandler: NewInMemoryDataHandler()}
+		testBatch(t, handler)
+		if handler.batchCalls == 0 {
+			t.Errorf("BatchDataHandler was not used")
+		}
+	})
+}
+
+func testBatch(t *testing.T, handler DataHandler) {
+	recorder := new(removalRecorder)
+	myCache := NewCache(handler, nil, WithReaperInterval(time.Hour))
+	defer myCache.Destroy()
+	myCache.OnEvict(recorder.record)
+	myCache.Put("foo", "old")
+	err := myCache.PutMany(map[string]interface{}{
+		"foo": "foo",
+		"bar": "bar",
+		"baz": "baz",
+	})
+	if err != nil {
+		t.Errorf("Cacher.PutMany() should not have error'd, got '%s'", err)
+	}
+	checkRemovals(t, "PutMany", recorder.take(), removalEvent{"foo", "old", Replaced})
+	found, missing, err := myCache.GetMany([]string{"foo", "bar", "qux", "baz", "quux"})
+	if err != nil {
+		t.Errorf("Cacher.GetMany() should not have error'd, got '%s'", err)
+	}
+	if len(found) != 3 || found["foo"] != "foo" || found["bar"] != "bar" || found["baz"] != "baz" {
+		t.Errorf("Cacher.GetMany() returned the wrong items, got '%#v'", found)
+	}
+	if len(missing) != 2 || missing[0] != "qux" || missing[1] != "quux" {
+		t.Errorf("Cacher.GetMany() returned the wrong missing keys, got '%#v'", missing)
+	}
+	if err = myCache.RemoveMany([]string{"foo", "bar", "qux"}); err != nil {
+		t.Errorf("Cacher.RemoveMany() should not have error'd, got '%s'", err)
+	}
+	checkRemovals(
+		t, "RemoveMany", recorder.take(),
+		removalEvent{"foo", "foo", Removed},
+		removalEvent{"bar", "bar", Removed},
+	)
+	_, missing, _ = myCache.GetMany([]string{"foo", "bar", "baz"})
+	sort.Strings(missing)
+	if len(missing) != 2 || missing[0] != "bar" || missing[1] != "foo" {
+		t.Errorf("Cacher.RemoveMany() removed the wrong items, missing '%#v'", missing)
+	}
+	// an expired item is replaced as a new one, the reaper never gets to it
+	myCache.PutWithTTL("qux", "old", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if err = myCache.PutMany(map[string]interface{}{"qux": "qux"}); err != nil {
+		t.Errorf("Cacher.PutMany() should not have error'd, got '%s'", err)
+	}
+	checkRemovals(t, "PutMany", recorder.take(), removalEvent{"qux", "old", Expired})
+	stats := myCache.Stats()
+	if stats.Puts != 6 || stats.Overwrites != 1 || stats.Removes != 2 || stats.Hits != 4 || stats.Misses != 4 ||
+		stats.Expirations != 1 || stats.Entries != 2 {
+		t.Errorf("batch operations were not counted, got\n%+v", stats)
+	}
+}
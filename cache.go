@@ -4,43 +4,179 @@
 package cache
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// Cacher primary interface for this package.
-type Cacher interface {
+// Cache is the generic, type safe form of Cacher. Values are stored and
+// returned as V, so callers do not need type assertions.
+type Cache[K comparable, V any] interface {
 	// Clear remove all elements from the cache.
 	Clear()
 	// Get a single element from the cache, if a second parameter is
 	// provided, will set the cache to that value if nothing is present
 	// returns a ValueNotPresentError if no value was found at key.
-	Get(string, ...interface{}) (interface{}, error)
+	Get(K, ...V) (V, error)
+	// GetWithTTL behaves like Get with a default value, an inserted value
+	// is removed once ttl has passed regardless of the Invalidator.
+	GetWithTTL(K, V, time.Duration) (V, error)
+	// GetContext is Get passing ctx on to the DataHandler, returns a
+	// TimeoutError if the deadline of ctx passes.
+	GetContext(context.Context, K, ...V) (V, error)
+	// GetOrLoad gets a single element from the cache, calling the Loader
+	// to compute and insert it if nothing is present. Concurrent calls for
+	// the same key share a single run of a Loader and its result. Loader errors
+	// are returned and not cached unless WithLoaderErrorCaching is used.
+	// Each call returns once its own ctx is done, the Loader gets a context
+	// with the values of ctx that is cancelled once the ctx of every call
+	// sharing the run is done, and a later call starts a new run. If the
+	// Loader panics, the call that started the run panics if it is still
+	// waiting and the others return a LoaderPanicError.
+	GetOrLoad(context.Context, K, Loader[V]) (V, error)
 	// Put a value at key, returns the previous value if present
-	Put(string, interface{}) (interface{}, error)
+	Put(K, V) (V, error)
+	// PutWithTTL behaves like Put, the value is removed once ttl has passed
+	// regardless of the Invalidator. Overwriting an item replaces its ttl,
+	// a ttl <= 0 is the same as Put.
+	PutWithTTL(K, V, time.Duration) (V, error)
+	// PutWithStale behaves like PutWithTTL, except the item is kept for
+	// stale longer after ttl has passed. Meanwhile it is still returned,
+	// GetStale says it is stale, and the first lookup reloads it in the
+	// background with the KeyLoader set by SetLoader. If the reload fails
+	// the stale value is kept until its stale window closes, and no reload
+	// is tried again for ttl, or the WithLoaderErrorCaching lifetime if set.
+	PutWithStale(key K, data V, ttl, stale time.Duration) (V, error)
+	// GetStale is Get without a default, also reporting whether the value
+	// is stale, see PutWithStale.
+	GetStale(K) (V, bool, error)
+	// PutContext is Put passing ctx on to the DataHandler, returns a
+	// TimeoutError if the deadline of ctx passes.
+	PutContext(context.Context, K, V) (V, error)
+	// GetMany gets the items at keys, returning the values found and the
+	// keys with nothing in the cache.
+	GetMany([]K) (map[K]V, []K, error)
+	// PutMany puts every item, nothing is stored if any item costs more
+	// than the budget set with WithMaxCost.
+	PutMany(map[K]V) error
 	// Remove a single item, returning the item or a ValueNotPresentError
 	// if no item is present.
-	Remove(string) (interface{}, error)
-	// Destroy the cache releasing resources.
+	Remove(K) (V, error)
+	// RemoveMany removes the items at keys, keys with nothing in the cache
+	// are ignored.
+	RemoveMany([]K) error
+	// RemoveContext is Remove passing ctx on to the DataHandler, returns a
+	// TimeoutError if the deadline of ctx passes.
+	RemoveContext(context.Context, K) (V, error)
+	// Destroy the cache releasing resources. The cache is cleared, then a
+	// DataHandler that is an io.Closer is closed. A PersistentDataHandler
+	// is closed without clearing it, so it keeps its items and OnEvict
+	// isn't told about them.
 	Destroy()
+	// OnEvict registers a function called with every item that leaves the
+	// cache and the reason it left. It runs synchronously in the goroutine
+	// removing the item, so it should not block.
+	OnEvict(func(K, V, RemovalReason))
+	// Stats returns the cache's counters, cheap enough to call often.
+	Stats() Stats
+	// ResetStats zeroes every counter in Stats except Entries.
+	ResetStats()
+	// PauseReaper stops items from expiring until ResumeReaper is called,
+	// neither the reaper nor Get remove expired items in the meantime.
+	// Capacity eviction carries on as usual.
+	PauseReaper()
+	// ResumeReaper undoes PauseReaper, items that expired in the meantime
+	// are removed on the next reaper pass.
+	ResumeReaper()
+	// SetLoader sets the KeyLoader used to reload items in the background,
+	// see WithRefreshAhead. A nil loader turns reloading off.
+	SetLoader(KeyLoader[K, V])
+	// Snapshot writes every item and its Metadata to the writer in a
+	// versioned format.
+	Snapshot(io.Writer) error
+	// Restore reads a Snapshot into the cache, dropping items that are
+	// already stale.
+	Restore(io.Reader) error
+}
+
+// Cacher primary interface for this package.
+// It is a Cache keyed by strings holding interface{} values, kept so
+// code written before Cache existed keeps compiling.
+type Cacher interface {
+	Cache[string, interface{}]
 }
 
 // NewCache returns a Cacher Interface whose behavior is determined by
 // datahandler and inv.
 // dataHandler defaults to an inMmeoryCache when nil.
 // inv defaults to a NopInvalidator when nil.
-func NewCache(dataHandler DataHandler, inv Invalidator) Cacher {
+func NewCache(dataHandler DataHandler, inv Invalidator, opts ...Option) Cacher {
+	if dataHandler == nil {
+		dataHandler = NewInMemoryDataHandler()
+	}
+	return newCache[string, interface{}](dataHandlerAdapter{dataHandler}, inv, opts)
+}
+
+// NewTypedCache returns a Cache whose behavior is determined by
+// dataHandler and inv.
+// dataHandler defaults to NewTypedInMemoryDataHandler when nil.
+// inv defaults to a NopInvalidator when nil.
+func NewTypedCache[K comparable, V any](
+	dataHandler TypedDataHandler[K, Element[V]], inv Invalidator, opts ...Option,
+) Cache[K, V] {
+	if dataHandler == nil {
+		dataHandler = NewTypedInMemoryDataHandler[K, Element[V]]()
+	}
+	return newCache[K, V](dataHandler, inv, opts)
+}
+
+func newCache[K comparable, V any](
+	dataHandler TypedDataHandler[K, Element[V]], inv Invalidator, opts []Option,
+) *cache[K, V] {
 	if inv == nil {
 		inv = &NopInvalidator{}
 	}
-	if dataHandler == nil {
-		dataHandler = NewInMemoryDataHandler()
+	config := newOptions(opts)
+	_, nop := inv.(*NopInvalidator)
+	expiring, _ := inv.(ExpiringInvalidator)
+	toRet := &cache[K, V]{
+		dataHandler:  contextHandler(dataHandler),
+		batch:        batchHandler(dataHandler),
+		reaper:       newReaper(inv),
+		loads:        newLoadGroup[K, V](config.loaderErrorTTL),
+		stats:        new(statsCounter),
+		expiries:     newExpiryQueue[K](),
+		expiring:     expiring,
+		fullScan:     !nop && expiring == nil,
+		reapInterval: config.reapInterval,
+		reapJitter:   config.reapJitter,
+		scanLimit:    config.scanLimit,
+		refreshAhead: config.refreshAhead,
+		refreshing:   make(map[K]int64),
+		negatives:    newExpiryQueue[K](),
+		negativeTTL:  config.negativeTTL,
+		quit:         make(chan int8),
+	}
+	if config.maxEntries > 0 || config.maxCost > 0 {
+		toRet.lru = newLRU[K](config.maxEntries, config.maxCost)
 	}
-	toRet := &cache{
-		dataHandler: dataHandler,
-		reaper:      newReaper(inv),
-		quit:        make(chan int8),
+	if config.maxCost > 0 {
+		toRet.cost = config.cost
 	}
+	if config.name != "" {
+		toRet.name = config.name
+		register(toRet.name, toRet)
+	}
+	var handler interface{} = dataHandler
+	if adapter, ok := handler.(dataHandlerAdapter); ok {
+		handler = adapter.DataHandler
+	}
+	toRet.closer, _ = handler.(io.Closer)
+	toRet.persistent = persistent(handler)
+	toRet.adopt()
 	go toRet.begin()
 	return toRet
 }
@@ -63,12 +199,50 @@ type DataHandler interface {
 	Range(func(string, interface{}) bool)
 }
 
+// TypedDataHandler is the generic counterpart of DataHandler, used by Cache
+// to store Elements. A DataHandler has the same method set as a
+// TypedDataHandler[string, interface{}].
+type TypedDataHandler[K comparable, V any] interface {
+	// Put a single item in the cache
+	Put(K, V) error
+	// Get a single item from the cache, must return a ValueNotPresentError
+	// if there is nothing in the cache there.
+	Get(K) (V, error)
+	// Clear removes all elements from the cache.
+	Clear() error
+	// Remove an item from the cache, returns a ValueNotPresentError
+	// if there was nothing in the cache at key.
+	Remove(K) error
+	// Range iterates through all items in the cache and calls
+	// the passed in function.  If the function returns false, iteration halts.
+	Range(func(K, V) bool)
+}
+
+// PersistentDataHandler is implemented by DataHandlers and TypedDataHandlers
+// whose items can outlive the cache, such as NewLogDataHandler. A cache
+// created over one whose Persistent returns true counts the items already
+// in it, and Cache.Destroy closes it without clearing it.
+type PersistentDataHandler interface {
+	io.Closer
+	// Persistent reports whether the items are kept across Close.
+	Persistent() bool
+}
+
+// persistent reports whether handler is a PersistentDataHandler keeping its
+// items across Close.
+func persistent(handler interface{}) bool {
+	p, ok := handler.(PersistentDataHandler)
+	return ok && p.Persistent()
+}
+
 // Invalidator is the interface that Cacher uses to determine if an item is valid.
 // If IsValid returns false, the item will be removed from the cache.
 type Invalidator interface {
 	// IsValid determines whether or not a cache item is valid.
-	// This package constantly loops through the cache in a background go routine
-	// calling IsValid on all items.
+	// The reaper polls it for every item in a background go routine, at
+	// most WithReaperScanLimit items per pass, and Cacher.Restore checks
+	// restored items with it. The reaper never polls a NopInvalidator or
+	// an ExpiringInvalidator.
 	IsValid(*Metadata) bool
 
 	// The following functions provide a means for implentations of this interface
@@ -85,6 +259,22 @@ type Invalidator interface {
 	UpdateExtra(*Metadata)
 }
 
+// ExpiringInvalidator is an optional extension of Invalidator for
+// invalidators that know when an item will stop being valid. The cache
+// detects it with a type assertion and uses it to remove items right at their
+// deadline rather than polling IsValid on every item, and to treat items
+// past their deadline as missing even before they are removed.
+//
+// IsValid is then ignored except by Cacher.Restore, so an item stays valid
+// until ExpiresAt however IsValid judges it. Any other validity logic must
+// be folded into ExpiresAt.
+type ExpiringInvalidator interface {
+	Invalidator
+	// ExpiresAt returns when the item stops being valid, false if it
+	// never does.
+	ExpiresAt(*Metadata) (time.Time, bool)
+}
+
 // ValueNotPresentError is returned when an item isn't found in the cache.
 type ValueNotPresentError struct {
 	Key string // The item key.
@@ -120,168 +310,575 @@ func (n *NopInvalidator) CreateExtra(*Metadata) {}
 // UpdateExtra does nothing, satisfies the Invalidator interface.
 func (n *NopInvalidator) UpdateExtra(*Metadata) {}
 
-type reaper struct {
-	*metadataHelper
-	Invalidator
+// Element is what a Cache stores in its TypedDataHandler, a value along
+// with the Metadata the Invalidator uses to validate it.
+type Element[V any] struct {
+	data     V
+	metadata Metadata
 }
 
-func newReaper(inv Invalidator) *reaper {
-	return &reaper{
-		newMetadataHelper(inv.AccessExtra, inv.CreateExtra, inv.UpdateExtra),
-		inv,
+// NewElement returns an Element holding data and metadata, for a
+// TypedDataHandler that rebuilds the Elements it stores, such as from bytes.
+// Most use DecodeElement instead.
+func NewElement[V any](data V, metadata Metadata) Element[V] {
+	return Element[V]{
+		data:     data,
+		metadata: metadata,
 	}
 }
 
-type cacheElement struct {
-	data     interface{}
-	metadata Metadata
+// Value returns the cached value.
+func (e Element[V]) Value() V {
+	return e.data
+}
+
+// Metadata returns the Metadata of the cached value.
+func (e Element[V]) Metadata() Metadata {
+	return e.metadata
+}
+
+// parts returns the value and Metadata of any Element as the same types,
+// see wireElement.
+func (e Element[V]) parts() (interface{}, Metadata) {
+	return e.data, e.metadata
+}
+
+type cacheElement = Element[interface{}]
+
+// dataHandlerAdapter lets a DataHandler back a Cache[string, interface{}].
+type dataHandlerAdapter struct {
+	DataHandler
+}
+
+func (d dataHandlerAdapter) Put(key string, elem cacheElement) error {
+	return d.DataHandler.Put(key, elem)
 }
 
-func (c *cache) Clear() {
+func (d dataHandlerAdapter) Get(key string) (cacheElement, error) {
+	found, err := d.DataHandler.Get(key)
+	return unpackElement(key, found, err)
+}
+
+func (d dataHandlerAdapter) GetContext(ctx context.Context, key string) (cacheElement, error) {
+	if ctxHandler, ok := d.DataHandler.(ContextDataHandler); ok {
+		found, err := ctxHandler.GetContext(ctx, key)
+		return unpackElement(key, found, err)
+	}
+	if err := ctx.Err(); err != nil {
+		return cacheElement{}, err
+	}
+	return d.Get(key)
+}
+
+func (d dataHandlerAdapter) PutContext(ctx context.Context, key string, elem cacheElement) error {
+	if ctxHandler, ok := d.DataHandler.(ContextDataHandler); ok {
+		return ctxHandler.PutContext(ctx, key, elem)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return d.Put(key, elem)
+}
+
+func (d dataHandlerAdapter) RemoveContext(ctx context.Context, key string) error {
+	if ctxHandler, ok := d.DataHandler.(ContextDataHandler); ok {
+		return ctxHandler.RemoveContext(ctx, key)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return d.Remove(key)
+}
+
+// unpackElement turns what a DataHandler returned for key back into a cacheElement.
+func unpackElement(key string, found interface{}, err error) (cacheElement, error) {
+	if err != nil {
+		return cacheElement{}, err
+	}
+	if found == nil {
+		return cacheElement{}, ValueNotPresentError{
+			Key: key,
+		}
+	}
+	elem, ok := found.(cacheElement)
+	if !ok {
+		return cacheElement{}, fmt.Errorf(
+			"cache may be corrupt, found something for key '%s', but can't unpack it",
+			key,
+		)
+	}
+	return elem, nil
+}
+
+func (d dataHandlerAdapter) Range(f func(string, cacheElement) bool) {
+	cb := func(key string, val interface{}) bool {
+		elem, ok := val.(cacheElement)
+		if !ok {
+			return true
+		}
+		return f(key, elem)
+	}
+	d.DataHandler.Range(cb)
+}
+
+// keyString renders a key for use in errors.
+func keyString[K comparable](key K) string {
+	if s, ok := interface{}(key).(string); ok {
+		return s
+	}
+	return fmt.Sprint(key)
+}
+
+func (c *cache[K, V]) Clear() {
+	c.clear()
+}
+
+// clear empties the cache, telling removal listeners about every item.
+func (c *cache[K, V]) clear() {
+	var all []removal[K, V]
+	if c.removals.active() {
+		c.dataHandler.Range(func(key K, elem Element[V]) bool {
+			all = append(all, removal[K, V]{key, elem.data, Cleared})
+			return true
+		})
+	}
 	c.reaper.Clear()
 	c.dataHandler.Clear()
+	c.loads.clear()
+	c.lru.clear()
+	c.expiries.clear()
+	c.negatives.clear()
+	c.forgetRefreshes()
+	c.removals.notifyAll(all)
+}
+
+// adopt accounts for items already in the DataHandler, such as a persistent
+// one reopened, without touching their Metadata.
+func (c *cache[K, V]) adopt() {
+	c.dataHandler.Range(func(key K, elem Element[V]) bool {
+		c.reaper.Adopt(&elem.metadata)
+		cost, _ := c.costOf(key, elem.data)
+		c.lru.add(key, cost)
+		c.expiries.schedule(key, c.deadline(&elem.metadata))
+		return true
+	})
+	c.evict()
+}
+
+func (c *cache[K, V]) OnEvict(f func(K, V, RemovalReason)) {
+	c.removals.add(f)
+}
+
+func (c *cache[K, V]) Put(key K, data V) (V, error) {
+	return c.PutContext(context.Background(), key, data)
 }
 
-func (c *cache) Put(key string, data interface{}) (interface{}, error) {
-	found, err := c.dataHandler.Get(key)
+func (c *cache[K, V]) PutWithTTL(key K, data V, ttl time.Duration) (V, error) {
+	return c.put(context.Background(), key, data, lifetime{ttl: ttl})
+}
+
+func (c *cache[K, V]) PutContext(ctx context.Context, key K, data V) (V, error) {
+	toRet, err := c.put(ctx, key, data, lifetime{})
+	return toRet, timeoutError(key, err)
+}
+
+// put is PutWithTTL honoring ctx.
+func (c *cache[K, V]) put(ctx context.Context, key K, data V, life lifetime) (V, error) {
+	var zero V
+	cost, err := c.costOf(key, data)
+	if err != nil {
+		return zero, err
+	}
+	unlock := c.keys.lock(key)
+	toRet, gone, err := c.store(ctx, key, data, cost, life)
+	unlock()
+	c.removals.notifyAll(gone)
+	if err != nil {
+		return toRet, err
+	}
+	c.evict()
+	return toRet, nil
+}
+
+// store is put for a caller holding the lock on key, returning the items it
+// replaced or found expired for the caller to tell the removal listeners
+// about.
+func (c *cache[K, V]) store(
+	ctx context.Context, key K, data V, cost int64, life lifetime,
+) (V, []removal[K, V], error) {
+	var zero V
+	var gone []removal[K, V]
+	found, err := c.dataHandler.GetContext(ctx, key)
+	if err == nil {
+		if reason, expired := c.expiry(&found.metadata, time.Now()); expired {
+			// the insert below overwrites what is left in the DataHandler
+			c.forget(key, reason)
+			gone = append(gone, removal[K, V]{key, found.data, reason})
+			err = ValueNotPresentError{Key: keyString(key)}
+		}
+	}
 	if err != nil {
 		if !IsValueNotPresentError(err) {
-			return nil, err
+			return zero, gone, err
 		}
-	} else if found != nil {
-		fCacheElem, ok := found.(cacheElement)
-		if !ok {
-			return nil, fmt.Errorf(
-				"cache may be corrupt, found something for key '%s', but can't unpack it",
-				key,
-			)
+	} else {
+		found.metadata.setLifetime(life)
+		c.reaper.Update(&found.metadata)
+		toRet := found.data
+		found.data = data
+		if err = c.dataHandler.PutContext(ctx, key, found); err != nil {
+			return toRet, gone, err
 		}
-		c.reaper.Update(&fCacheElem.metadata)
-		toRet := fCacheElem.data
-		fCacheElem.data = data
-		c.dataHandler.Put(key, fCacheElem)
-		return toRet, nil
+		atomic.AddInt64(&c.stats.puts, 1)
+		atomic.AddInt64(&c.stats.overwrites, 1)
+		c.expiries.schedule(key, c.deadline(&found.metadata))
+		c.lru.add(key, cost)
+		return toRet, append(gone, removal[K, V]{key, toRet, Replaced}), nil
 	}
+	if err = c.insert(ctx, key, data, cost, life); err != nil {
+		return zero, gone, err
+	}
+	atomic.AddInt64(&c.stats.puts, 1)
+	return zero, gone, nil
+}
+
+// insert stores a new item at key for a caller holding the lock on key, the
+// caller evicts the least recently used items once it is unlocked if that
+// puts the cache over capacity.
+func (c *cache[K, V]) insert(
+	ctx context.Context, key K, data V, cost int64, life lifetime,
+) error {
 	metadata := Metadata{}
+	metadata.setLifetime(life)
 	c.reaper.Create(&metadata)
-	err = c.dataHandler.Put(
+	err := c.dataHandler.PutContext(
+		ctx,
 		key,
-		cacheElement{
+		Element[V]{
 			data:     data,
 			metadata: metadata,
 		},
 	)
 	if err != nil {
-		return nil, err
+		c.reaper.Remove()
+		return err
+	}
+	c.expiries.schedule(key, c.deadline(&metadata))
+	c.negatives.remove(key)
+	c.lru.add(key, cost)
+	return nil
+}
+
+// costOf returns the cost of data at key, or a CostExceededError if it
+// can never fit in the cache.
+func (c *cache[K, V]) costOf(key K, data V) (int64, error) {
+	if c.cost == nil {
+		return 0, nil
+	}
+	sKey := keyString(key)
+	cost := c.cost(sKey, data)
+	if !c.lru.fits(cost) {
+		return cost, CostExceededError{
+			Key:     sKey,
+			Cost:    cost,
+			MaxCost: c.lru.maxCost,
+		}
+	}
+	return cost, nil
+}
+
+// evict removes the least recently used items until the cache is within
+// its capacity.
+func (c *cache[K, V]) evict() {
+	for {
+		key, ok := c.lru.overflow()
+		if !ok {
+			return
+		}
+		unlock := c.keys.lock(key)
+		var found Element[V]
+		if c.removals.active() {
+			found, _ = c.dataHandler.Get(key)
+		}
+		err := c.dataHandler.Remove(key)
+		if err == nil {
+			c.forget(key, Evicted)
+		}
+		unlock()
+		if err == nil {
+			c.removals.notify(key, found.data, Evicted)
+		}
 	}
-	return nil, nil
 }
 
-func (c *cache) Get(key string, data ...interface{}) (interface{}, error) {
+func (c *cache[K, V]) Get(key K, data ...V) (V, error) {
+	return c.GetContext(context.Background(), key, data...)
+}
+
+func (c *cache[K, V]) GetWithTTL(key K, data V, ttl time.Duration) (V, error) {
+	return c.get(context.Background(), key, []V{data}, ttl)
+}
+
+func (c *cache[K, V]) GetContext(ctx context.Context, key K, data ...V) (V, error) {
+	var zero V
 	if len(data) > 1 {
-		return nil, fmt.Errorf(
+		return zero, fmt.Errorf(
 			"only a single value can be sent to Get to be cached as a default, attemped to pass %d items",
 			len(data),
 		)
 	}
-	found, err := c.dataHandler.Get(key)
-	if err != nil {
-		//new element
-		ok := IsValueNotPresentError(err)
-		if ok {
-			if len(data) == 1 {
-				metadata := Metadata{}
-				c.reaper.Create(&metadata)
-				putErr := c.dataHandler.Put(
-					key,
-					cacheElement{
-						data:     data[0],
-						metadata: metadata,
-					},
-				)
-				if putErr != nil {
-					return nil, putErr
-				}
-				return data[0], nil
-			}
-			return nil, err
+	found, err := c.get(ctx, key, data, 0)
+	return found, timeoutError(key, err)
+}
+
+// get is GetContext where ttl is the lifetime of an inserted default.
+func (c *cache[K, V]) get(ctx context.Context, key K, data []V, ttl time.Duration) (V, error) {
+	if len(data) == 0 {
+		found, err := c.getElement(ctx, key)
+		return found.data, err
+	}
+	var zero V
+	unlock := c.keys.lock(key)
+	found, _, gone, err := c.find(ctx, key)
+	if err == nil || !IsValueNotPresentError(err) {
+		unlock()
+		c.removals.notifyAll(gone)
+		if err != nil {
+			return zero, err
 		}
+		atomic.AddInt64(&c.stats.hits, 1)
+		return found.data, nil
 	}
-	foundCacheElem, ok := found.(cacheElement)
-	if !ok {
-		return nil, fmt.Errorf(
-			"cache may be corrupt, found something for key '%s', but can't unpack it",
-			key,
-		)
+	atomic.AddInt64(&c.stats.misses, 1)
+	//new element
+	cost, err := c.costOf(key, data[0])
+	if err == nil {
+		err = c.insert(ctx, key, data[0], cost, lifetime{ttl: ttl})
 	}
-	c.reaper.Access(&foundCacheElem.metadata)
-	err = c.dataHandler.Put(key, foundCacheElem)
-	return foundCacheElem.data, err
+	unlock()
+	c.removals.notifyAll(gone)
+	if err != nil {
+		return zero, err
+	}
+	atomic.AddInt64(&c.stats.getInserts, 1)
+	c.evict()
+	return data[0], nil
 }
 
-func (c *cache) Remove(key string) (interface{}, error) {
-	found, err := c.dataHandler.Get(key)
-	if err != nil {
-		return nil, err
+// getElement is Get without a default, returning the item's Metadata along
+// with its value.
+func (c *cache[K, V]) getElement(ctx context.Context, key K) (Element[V], error) {
+	found, _, err := c.lookup(ctx, key)
+	if err == nil {
+		atomic.AddInt64(&c.stats.hits, 1)
+		return found, nil
 	}
-	if found == nil {
-		return nil, ValueNotPresentError{
-			Key: key,
+	if IsValueNotPresentError(err) {
+		if negErr := c.negativeHit(key); negErr != nil {
+			return found, negErr
 		}
+		atomic.AddInt64(&c.stats.misses, 1)
 	}
-	err = c.dataHandler.Remove(key)
+	return found, err
+}
+
+// lookup finds the item at key and records the access, reporting whether
+// the item is stale.
+func (c *cache[K, V]) lookup(ctx context.Context, key K) (Element[V], bool, error) {
+	unlock := c.keys.lock(key)
+	found, stale, gone, err := c.find(ctx, key)
+	unlock()
+	c.removals.notifyAll(gone)
+	return found, stale, err
+}
+
+// find is lookup for a caller holding the lock on key, returning the item
+// it removed as expired for the caller to tell the removal listeners about.
+func (c *cache[K, V]) find(ctx context.Context, key K) (Element[V], bool, []removal[K, V], error) {
+	found, err := c.dataHandler.GetContext(ctx, key)
 	if err != nil {
-		return nil, err
+		return Element[V]{}, false, nil, err
 	}
-	cElem, ok := found.(cacheElement)
-	if !ok {
-		return nil, fmt.Errorf(
-			"cache may be corrupt, found something for key '%s', but can't unpack it",
-			key,
-		)
+	if reason, expired := c.expiry(&found.metadata, time.Now()); expired {
+		var gone []removal[K, V]
+		if c.dataHandler.RemoveContext(ctx, key) == nil {
+			c.forget(key, reason)
+			gone = append(gone, removal[K, V]{key, found.data, reason})
+		}
+		return Element[V]{}, false, gone, ValueNotPresentError{Key: keyString(key)}
 	}
-	c.reaper.Remove()
-	return cElem.data, nil
+	stale := c.accessed(key, &found.metadata, time.Now())
+	c.reaper.Access(&found.metadata)
+	if c.expiring != nil {
+		c.expiries.schedule(key, c.deadline(&found.metadata))
+	}
+	c.lru.touch(key)
+	err = c.dataHandler.PutContext(ctx, key, found)
+	return found, stale, nil, err
 }
 
-func (c *cache) Destroy() {
-	c.dataHandler.Clear()
-	c.reaper.Clear()
-	close(c.quit)
+// lifetimeLoader is a Loader that also says how long the value lives.
+type lifetimeLoader[V any] func(context.Context) (V, lifetime, error)
+
+func (c *cache[K, V]) GetOrLoad(ctx context.Context, key K, loader Loader[V]) (V, error) {
+	return c.getOrLoad(ctx, key, func(ctx context.Context) (V, lifetime, error) {
+		val, err := loader(ctx)
+		return val, lifetime{}, err
+	})
 }
 
-func (c *cache) begin() {
-	cb := func(key string, val interface{}) bool {
-		select {
-		case <-c.quit:
-			return false
-		default:
+// getOrLoad is GetOrLoad storing loaded values with the lifetime loader
+// returns.
+func (c *cache[K, V]) getOrLoad(ctx context.Context, key K, loader lifetimeLoader[V]) (V, error) {
+	found, err := c.get(ctx, key, nil, 0)
+	if err == nil || !IsValueNotPresentError(err) {
+		return found, timeoutError(key, err)
+	}
+	return c.load(ctx, key, loader)
+}
+
+// load runs loader for a key that was just missed, sharing the run with
+// other loads of key.
+func (c *cache[K, V]) load(ctx context.Context, key K, loader lifetimeLoader[V]) (V, error) {
+	load := func(ctx context.Context) (V, error) {
+		// a load for key may have finished between the miss and now
+		if found, _, err := c.lookup(ctx, key); err == nil || !IsValueNotPresentError(err) {
+			return found.data, err
 		}
-		elem, ok := val.(cacheElement)
-		if !ok {
-			return true
+		var zero V
+		if err := c.negativeHit(key); err != nil {
+			return zero, err
 		}
-		if !c.reaper.IsValid(&elem.metadata) {
-			c.dataHandler.Remove(key)
-			c.reaper.Remove()
+		atomic.AddInt64(&c.stats.loaderCalls, 1)
+		val, life, err := loader(ctx)
+		if err != nil {
+			if c.negativeTTL > 0 && notFound(err) {
+				return val, c.rememberNotFound(key)
+			}
+			atomic.AddInt64(&c.stats.loaderErrors, 1)
+			return val, err
 		}
-		return true
+		_, err = c.put(ctx, key, val, life)
+		return val, err
 	}
-	dur, _ := time.ParseDuration("100ms")
-	myTicker := time.NewTicker(dur)
-	for {
-		select {
-		case <-c.quit:
-			myTicker.Stop()
-			return
-		case <-myTicker.C:
-			c.dataHandler.Range(cb)
-		}
+	found, err := c.loads.do(ctx, key, load)
+	return found, timeoutError(key, err)
+}
+
+func (c *cache[K, V]) Remove(key K) (V, error) {
+	return c.RemoveContext(context.Background(), key)
+}
+
+func (c *cache[K, V]) RemoveContext(ctx context.Context, key K) (V, error) {
+	var zero V
+	unlock := c.keys.lock(key)
+	found, err := c.dataHandler.GetContext(ctx, key)
+	if err == nil {
+		err = c.dataHandler.RemoveContext(ctx, key)
+	}
+	if err != nil {
+		unlock()
+		return zero, timeoutError(key, err)
+	}
+	c.forget(key, Removed)
+	unlock()
+	c.removals.notify(key, found.data, Removed)
+	return found.data, nil
+}
+
+// removed does the bookkeeping for an item that was just removed from the
+// DataHandler for reason and tells the removal listeners.
+func (c *cache[K, V]) removed(key K, val V, reason RemovalReason) {
+	c.forget(key, reason)
+	c.removals.notify(key, val, reason)
+}
+
+// forget is removed without telling the removal listeners, for a caller
+// holding the lock on key.
+func (c *cache[K, V]) forget(key K, reason RemovalReason) {
+	c.reaper.Remove()
+	c.lru.remove(key)
+	c.expiries.remove(key)
+	c.forgetRefresh(key)
+	switch reason {
+	case Expired, Invalidated:
+		atomic.AddInt64(&c.stats.expirations, 1)
+	case Evicted:
+		atomic.AddInt64(&c.stats.evictions, 1)
+	case Removed:
+		atomic.AddInt64(&c.stats.removes, 1)
+	}
+}
+
+func (c *cache[K, V]) Stats() Stats {
+	toRet := c.stats.snapshot()
+	toRet.Entries = c.reaper.Len()
+	toRet.NegativeEntries = int64(c.negatives.len())
+	return toRet
+}
+
+func (c *cache[K, V]) ResetStats() {
+	c.stats.reset()
+}
+
+func (c *cache[K, V]) Destroy() {
+	if c.name != "" {
+		unregister(c.name, c)
 	}
+	if c.persistent {
+		c.reaper.Clear()
+		c.loads.clear()
+		c.lru.clear()
+		c.expiries.clear()
+		c.negatives.clear()
+	} else {
+		c.clear()
+	}
+	if c.closer != nil {
+		c.closer.Close()
+	}
+	close(c.quit)
 }
 
-type cache struct {
-	dataHandler DataHandler
+type cache[K comparable, V any] struct {
+	dataHandler TypedContextDataHandler[K, Element[V]]
+	batch       TypedBatchDataHandler[K, Element[V]]
 	reaper      *reaper
+	loads       *loadGroup[K, V]
+	// keys serializes reading, then writing, an item
+	keys keyLocks[K]
+	// lru is nil unless the cache has a capacity
+	lru *lru[K]
+	// cost is nil unless the cache has a cost budget
+	cost     CostFunc
+	removals removalListeners[K, V]
+	stats    *statsCounter
+	expiries *expiryQueue[K]
+	// expiring is nil unless the Invalidator is an ExpiringInvalidator
+	expiring ExpiringInvalidator
+	// fullScan is set when the Invalidator can't say when an item expires
+	fullScan     bool
+	reapInterval time.Duration
+	reapJitter   time.Duration
+	scanLimit    int
+	cursor       scanCursor[K]
+	paused       int32
+	// name is empty unless the cache is exported with WithName
+	name string
+	// closer is nil unless the DataHandler is an io.Closer
+	closer io.Closer
+	// persistent is set when the DataHandler keeps its items across Close
+	persistent bool
+	// refreshAhead is the WithRefreshAhead fraction, loader the KeyLoader
+	// and refreshing the keys being reloaded, 0, or whose last reload
+	// failed, when to retry in Unix nanoseconds
+	refreshAhead float64
+	loader       atomic.Value
+	refreshMu    sync.Mutex
+	refreshing   map[K]int64
+	// negatives holds the keys cached as not found by WithNegativeCaching,
+	// until their deadline
+	negatives   *expiryQueue[K]
+	negativeTTL time.Duration
 	quit        chan int8
 }
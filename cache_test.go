@@ -16,6 +16,68 @@ func TestCache(t *testing.T) {
 	t.Run("method=Remove", testRemove)
 	t.Run("method=Clear", testClear)
 	t.Run("mechanic=Count", testCount)
+	t.Run("mechanic=TTL", testTTL)
+}
+
+func testTTL(t *testing.T) {
+	myCache := NewCache(nil, nil)
+	defer myCache.Destroy()
+	short, _ := time.ParseDuration("200ms")
+	myCache.PutWithTTL("foo", "foo", short)
+	myCache.GetWithTTL("bar", "bar", short)
+	myCache.PutWithTTL("baz", "baz", 10*short)
+	myCache.Put("qux", "qux")
+	found, err := myCache.Get("foo")
+	if err != nil || found != "foo" {
+		t.Errorf("Cacher.PutWithTTL() item should be present, got '%#v', '%v'", found, err)
+	}
+	time.Sleep(2 * short)
+	for _, key := range []string{"foo", "bar"} {
+		if _, err := myCache.Get(key); !IsValueNotPresentError(err) {
+			t.Errorf("item at '%s' should have expired, got '%v'", key, err)
+		}
+	}
+	for _, key := range []string{"baz", "qux"} {
+		if found, err := myCache.Get(key); err != nil || found != key {
+			t.Errorf("item at '%s' should not have expired, got '%#v', '%v'", key, found, err)
+		}
+	}
+}
+
+func TestTypedCache(t *testing.T) {
+	myCache := NewTypedCache[int, *simple](nil, nil)
+	defer myCache.Destroy()
+	foo := &simple{key: "foo", bar: "bar"}
+	prev, err := myCache.Put(1, foo)
+	if err != nil {
+		t.Errorf("Cache.Put() should not have error'd, got '%s'", err)
+	}
+	if prev != nil {
+		t.Errorf("Cache.Put() initial insert should return nil, returned: '%#v'", prev)
+	}
+	found, err := myCache.Get(1)
+	if err != nil {
+		t.Errorf("Cache.Get() should not have error'd, got '%s'", err)
+	}
+	if found != foo {
+		t.Errorf("Cache.Get() expected '%#v', got '%#v'", foo, found)
+	}
+	bar := &simple{key: "bar", bar: "baz"}
+	found, err = myCache.Get(2, bar)
+	if err != nil || found != bar {
+		t.Errorf("Cache.Get() did not insert the default, got '%#v', '%v'", found, err)
+	}
+	removed, err := myCache.Remove(1)
+	if err != nil || removed != foo {
+		t.Errorf("Cache.Remove() expected '%#v', got '%#v', '%v'", foo, removed, err)
+	}
+	found, err = myCache.Get(1)
+	if found != nil || !IsValueNotPresentError(err) {
+		t.Errorf("Cache.Get() should have returned a ValueNotPresentError, got '%v'", err)
+	}
+	if err != nil && err.(ValueNotPresentError).Key != "1" {
+		t.Errorf("ValueNotPresentError.Key expected '1', got '%s'", err.(ValueNotPresentError).Key)
+	}
 }
 
 func testCount(t *testing.T) {
@@ -581,3 +643,12 @@ func ExampleNewInMemoryDataHandler() {
 	}
 	// Output: equal
 }
+
+func ExampleNewTypedCache() {
+	myCache := NewTypedCache[string, int](nil, nil)
+	myCache.Put("foo", 42)
+	found, _ := myCache.Get("foo")
+	// found is an int, no type assertion needed.
+	fmt.Println(found + 1)
+	// Output: 43
+}
@@ -0,0 +1,167 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Codec turns values into bytes and back, used by DataHandlers that store
+// bytes rather than Go values.
+type Codec interface {
+	// Marshal encodes a value.
+	Marshal(interface{}) ([]byte, error)
+	// Unmarshal decodes a value encoded by Marshal.
+	Unmarshal([]byte) (interface{}, error)
+}
+
+// typeRegistry maps names to the concrete types held in interface{} values so
+// codecs can rebuild them.
+var typeRegistry = struct {
+	sync.RWMutex
+	types map[string]reflect.Type
+	names map[reflect.Type]string
+}{
+	types: make(map[string]reflect.Type),
+	names: make(map[reflect.Type]string),
+}
+
+func init() {
+	// gob registers these itself
+	for _, val := range []interface{}{
+		"", []byte(nil), false,
+		int(0), int8(0), int16(0), int32(0), int64(0),
+		uint(0), uint8(0), uint16(0), uint32(0), uint64(0),
+		float32(0), float64(0),
+	} {
+		registerType(reflect.TypeOf(val).String(), val)
+	}
+}
+
+// RegisterType records the concrete type of value under name, so codecs can
+// decode interface{} values holding it back to that type. Like gob.RegisterName
+// it panics if name or the type is already registered differently, call it
+// from init.
+func RegisterType(name string, value interface{}) {
+	registerType(name, value)
+	gob.RegisterName(name, value)
+}
+
+func registerType(name string, value interface{}) {
+	typ := reflect.TypeOf(value)
+	typeRegistry.Lock()
+	defer typeRegistry.Unlock()
+	if t, ok := typeRegistry.types[name]; ok && t != typ {
+		panic(fmt.Sprintf("cache: registering duplicate types for %q: %s != %s", name, t, typ))
+	}
+	if n, ok := typeRegistry.names[typ]; ok && n != name {
+		panic(fmt.Sprintf("cache: registering duplicate names for %s: %q != %q", typ, n, name))
+	}
+	typeRegistry.types[name] = typ
+	typeRegistry.names[typ] = name
+}
+
+func registeredName(typ reflect.Type) (string, bool) {
+	typeRegistry.RLock()
+	defer typeRegistry.RUnlock()
+	name, ok := typeRegistry.names[typ]
+	return name, ok
+}
+
+func registeredType(name string) (reflect.Type, bool) {
+	typeRegistry.RLock()
+	defer typeRegistry.RUnlock()
+	typ, ok := typeRegistry.types[name]
+	return typ, ok
+}
+
+// GobCodec encodes values with encoding/gob, concrete types other than the
+// basic ones must be registered with RegisterType or gob.Register.
+type GobCodec struct{}
+
+// Marshal encodes val with encoding/gob.
+func (g GobCodec) Marshal(val interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&val); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decodes a value encoded by Marshal.
+func (g GobCodec) Unmarshal(data []byte) (interface{}, error) {
+	var toRet interface{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&toRet); err != nil {
+		return nil, err
+	}
+	return toRet, nil
+}
+
+// JSONCodec encodes values with encoding/json along with the name their
+// type was registered under. Values of unregistered types decode to whatever
+// encoding/json produces for an interface{}.
+type JSONCodec struct{}
+
+type jsonValue struct {
+	Type  string          `json:"type,omitempty"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Marshal encodes val with encoding/json.
+func (j JSONCodec) Marshal(val interface{}) ([]byte, error) {
+	data, err := json.Marshal(val)
+	if err != nil {
+		return nil, err
+	}
+	name, _ := registeredName(reflect.TypeOf(val))
+	return json.Marshal(jsonValue{
+		Type:  name,
+		Value: data,
+	})
+}
+
+// Unmarshal decodes a value encoded by Marshal.
+func (j JSONCodec) Unmarshal(data []byte) (interface{}, error) {
+	var wrapped jsonValue
+	if err := json.Unmarshal(data, &wrapped); err != nil {
+		return nil, err
+	}
+	if wrapped.Type == "" {
+		var toRet interface{}
+		err := json.Unmarshal(wrapped.Value, &toRet)
+		return toRet, err
+	}
+	typ, ok := registeredType(wrapped.Type)
+	if !ok {
+		return nil, fmt.Errorf("type %q is not registered", wrapped.Type)
+	}
+	toRet := reflect.New(typ)
+	if err := json.Unmarshal(wrapped.Value, toRet.Interface()); err != nil {
+		return nil, err
+	}
+	return toRet.Elem().Interface(), nil
+}
+
+// RawCodec passes []byte and string values through untouched, anything else
+// is an error. Unmarshal always returns a []byte.
+type RawCodec struct{}
+
+// Marshal returns val as bytes.
+func (r RawCodec) Marshal(val interface{}) ([]byte, error) {
+	switch v := val.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	default:
+		return nil, fmt.Errorf("RawCodec cannot encode %T", val)
+	}
+}
+
+// Unmarshal returns a copy of data.
+func (r RawCodec) Unmarshal(data []byte) (interface{}, error) {
+	return append([]byte(nil), data...), nil
+}
@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"reflect"
+	"testing"
+)
+
+type codecPoint struct {
+	X, Y int
+}
+
+func init() {
+	RegisterType("cache.codecPoint", codecPoint{})
+}
+
+func TestCodec(t *testing.T) {
+	values := []interface{}{
+		"foo", 42, int64(-7), 3.5, true, []byte("bar"),
+		codecPoint{1, 2},
+	}
+	for _, codec := range []Codec{GobCodec{}, JSONCodec{}} {
+		name := reflect.TypeOf(codec).Name()
+		t.Run(name, func(t *testing.T) {
+			for _, val := range values {
+				data, err := codec.Marshal(val)
+				if err != nil {
+					t.Errorf("%s.Marshal(%#v) returned an error, %v", name, val, err)
+					continue
+				}
+				found, err := codec.Unmarshal(data)
+				if err != nil || !reflect.DeepEqual(found, val) {
+					t.Errorf("%s.Unmarshal() expected '%#v', got '%#v', '%v'", name, val, found, err)
+				}
+			}
+		})
+	}
+
+	t.Run("JSONCodec unregistered", func(t *testing.T) {
+		type unregistered struct {
+			Foo string
+		}
+		data, err := JSONCodec{}.Marshal(unregistered{"bar"})
+		if err != nil {
+			t.Fatalf("JSONCodec.Marshal() returned an error, %v", err)
+		}
+		found, err := JSONCodec{}.Unmarshal(data)
+		expected := map[string]interface{}{"Foo": "bar"}
+		if err != nil || !reflect.DeepEqual(found, expected) {
+			t.Errorf("JSONCodec.Unmarshal() expected '%#v', got '%#v', '%v'", expected, found, err)
+		}
+	})
+
+	t.Run("RawCodec", func(t *testing.T) {
+		for _, val := range []interface{}{"foo", []byte("foo")} {
+			data, err := RawCodec{}.Marshal(val)
+			if err != nil {
+				t.Errorf("RawCodec.Marshal(%#v) returned an error, %v", val, err)
+			}
+			found, _ := RawCodec{}.Unmarshal(data)
+			if !reflect.DeepEqual(found, []byte("foo")) {
+				t.Errorf("RawCodec.Unmarshal() expected 'foo', got '%#v'", found)
+			}
+		}
+		if _, err := (RawCodec{}).Marshal(42); err == nil {
+			t.Errorf("RawCodec.Marshal() should have rejected an int")
+		}
+	})
+
+	t.Run("RegisterType", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("RegisterType() should have panicked on a duplicate name")
+			}
+		}()
+		RegisterType("cache.codecPoint", "not a point")
+	})
+}
@@ -0,0 +1,222 @@
+package cache
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// Compression is the algorithm a compressed entry was written with, stored
+// in the first byte of every entry so entries written with different
+// settings can be read back.
+type Compression byte
+
+const (
+	// NoCompression marks an entry stored as is.
+	NoCompression Compression = iota
+	// Gzip compresses with compress/gzip.
+	Gzip
+	// Flate compresses with compress/flate.
+	Flate
+)
+
+func (c Compression) String() string {
+	switch c {
+	case NoCompression:
+		return "none"
+	case Gzip:
+		return "gzip"
+	case Flate:
+		return "flate"
+	default:
+		return fmt.Sprintf("Compression(%d)", byte(c))
+	}
+}
+
+// CompressionStats counts what a CompressingDataHandler has written.
+type CompressionStats struct {
+	// Compressed is the number of entries stored compressed.
+	Compressed int64
+	// Uncompressed is the number of entries under the threshold, or that
+	// did not get smaller, stored as is.
+	Uncompressed int64
+	// BytesIn is the encoded size of every entry before compression.
+	BytesIn int64
+	// BytesOut is the size of every entry as stored.
+	BytesOut int64
+}
+
+// Ratio is BytesIn over BytesOut, 0 before anything is written.
+func (s CompressionStats) Ratio() float64 {
+	if s.BytesOut == 0 {
+		return 0
+	}
+	return float64(s.BytesIn) / float64(s.BytesOut)
+}
+
+// CompressingDataHandler is a DataHandler that compresses what it stores.
+type CompressingDataHandler interface {
+	DataHandler
+	// CompressionStats returns the counts since the handler was created.
+	CompressionStats() CompressionStats
+}
+
+// NewCompressingDataHandler returns a DataHandler that encodes values with
+// EncodeValue and codec, compresses those of at least threshold bytes with
+// algorithm and stores the result in dataHandler as a []byte. A nil codec
+// uses GobCodec.
+func NewCompressingDataHandler(dataHandler DataHandler, codec Codec, algorithm Compression, threshold int) CompressingDataHandler {
+	if codec == nil {
+		codec = GobCodec{}
+	}
+	return &compressing{
+		dataHandler: dataHandler,
+		codec:       codec,
+		algorithm:   algorithm,
+		threshold:   threshold,
+	}
+}
+
+type compressing struct {
+	dataHandler  DataHandler
+	codec        Codec
+	algorithm    Compression
+	threshold    int
+	compressed   int64
+	uncompressed int64
+	bytesIn      int64
+	bytesOut     int64
+}
+
+func (c *compressing) compress(data []byte) ([]byte, error) {
+	if c.algorithm == NoCompression || len(data) < c.threshold {
+		return append([]byte{byte(NoCompression)}, data...), nil
+	}
+	buf := bytes.NewBuffer([]byte{byte(c.algorithm)})
+	var w io.WriteCloser
+	switch c.algorithm {
+	case Gzip:
+		w = gzip.NewWriter(buf)
+	case Flate:
+		w, _ = flate.NewWriter(buf, flate.DefaultCompression)
+	default:
+		return nil, fmt.Errorf("unknown compression %v", c.algorithm)
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	if buf.Len() > len(data) {
+		// not worth it
+		return append([]byte{byte(NoCompression)}, data...), nil
+	}
+	return buf.Bytes(), nil
+}
+
+func decompress(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("cannot decompress an empty entry")
+	}
+	var r io.Reader
+	switch Compression(data[0]) {
+	case NoCompression:
+		return data[1:], nil
+	case Gzip:
+		gr, err := gzip.NewReader(bytes.NewReader(data[1:]))
+		if err != nil {
+			return nil, err
+		}
+		r = gr
+	case Flate:
+		r = flate.NewReader(bytes.NewReader(data[1:]))
+	default:
+		return nil, fmt.Errorf("unknown compression %v", Compression(data[0]))
+	}
+	return io.ReadAll(r)
+}
+
+func (c *compressing) Put(key string, data interface{}) error {
+	encoded, err := EncodeValue(c.codec, data)
+	if err != nil {
+		return err
+	}
+	stored, err := c.compress(encoded)
+	if err != nil {
+		return err
+	}
+	if Compression(stored[0]) == NoCompression {
+		atomic.AddInt64(&c.uncompressed, 1)
+	} else {
+		atomic.AddInt64(&c.compressed, 1)
+	}
+	atomic.AddInt64(&c.bytesIn, int64(len(encoded)))
+	atomic.AddInt64(&c.bytesOut, int64(len(stored)))
+	return c.dataHandler.Put(key, stored)
+}
+
+// decode turns an entry read from the wrapped DataHandler back into a value.
+func (c *compressing) decode(key string, stored interface{}) (interface{}, error) {
+	data, ok := stored.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("%s is a %T, not a compressed entry", key, stored)
+	}
+	encoded, err := decompress(data)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeValue(c.codec, encoded)
+}
+
+func (c *compressing) Get(key string) (interface{}, error) {
+	stored, err := c.dataHandler.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return c.decode(key, stored)
+}
+
+// Close closes the wrapped DataHandler if it is an io.Closer.
+func (c *compressing) Close() error {
+	if closer, ok := c.dataHandler.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Persistent reports whether the wrapped DataHandler is persistent.
+func (c *compressing) Persistent() bool {
+	return persistent(c.dataHandler)
+}
+
+func (c *compressing) Clear() error {
+	return c.dataHandler.Clear()
+}
+
+func (c *compressing) Remove(key string) error {
+	return c.dataHandler.Remove(key)
+}
+
+// Range skips entries that cannot be decoded.
+func (c *compressing) Range(f func(string, interface{}) bool) {
+	c.dataHandler.Range(func(key string, stored interface{}) bool {
+		val, err := c.decode(key, stored)
+		if err != nil {
+			return true
+		}
+		return f(key, val)
+	})
+}
+
+func (c *compressing) CompressionStats() CompressionStats {
+	return CompressionStats{
+		Compressed:   atomic.LoadInt64(&c.compressed),
+		Uncompressed: atomic.LoadInt64(&c.uncompressed),
+		BytesIn:      atomic.LoadInt64(&c.bytesIn),
+		BytesOut:     atomic.LoadInt64(&c.bytesOut),
+	}
+}
@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompressingDataHandler(t *testing.T) {
+	page := strings.Repeat("<p>hello world</p>", 100)
+	for _, algorithm := range []Compression{Gzip, Flate} {
+		t.Run(algorithm.String(), func(t *testing.T) {
+			inner := NewInMemoryDataHandler()
+			handler := NewCompressingDataHandler(inner, nil, algorithm, 64)
+			myCache := NewCache(handler, nil)
+			defer myCache.Destroy()
+			myCache.Put("page", page)
+			myCache.Put("small", "foo")
+			if found, err := myCache.Get("page"); err != nil || found != page {
+				t.Errorf("Cacher.Get() expected the page back, got '%v'", err)
+			}
+			if found, err := myCache.Get("small"); err != nil || found != "foo" {
+				t.Errorf("Cacher.Get() expected 'foo', got '%#v', '%v'", found, err)
+			}
+			stored, _ := inner.Get("page")
+			if Compression(stored.([]byte)[0]) != algorithm || len(stored.([]byte)) >= len(page) {
+				t.Errorf("page should have been stored with %v, got %d bytes", algorithm, len(stored.([]byte)))
+			}
+			stored, _ = inner.Get("small")
+			if Compression(stored.([]byte)[0]) != NoCompression {
+				t.Errorf("small should have been stored as is")
+			}
+			stats := handler.CompressionStats()
+			if stats.Compressed < 1 || stats.Uncompressed < 1 || stats.Ratio() < 5 {
+				t.Errorf("CompressionStats() expected a ratio over 5, got %+v, %.2f", stats, stats.Ratio())
+			}
+			count := 0
+			handler.Range(func(string, interface{}) bool {
+				count++
+				return true
+			})
+			if count != 2 {
+				t.Errorf("Range() expected %d items, got %d", 2, count)
+			}
+		})
+	}
+
+	t.Run("mixed", func(t *testing.T) {
+		// entries written with one algorithm read back with another
+		inner := NewInMemoryDataHandler()
+		NewCompressingDataHandler(inner, nil, Gzip, 0).Put("foo", []byte(strings.Repeat("a", 100)))
+		found, err := NewCompressingDataHandler(inner, nil, NoCompression, 0).Get("foo")
+		if err != nil || string(found.([]byte)) != strings.Repeat("a", 100) {
+			t.Errorf("Get() expected the value back, got '%#v', '%v'", found, err)
+		}
+		inner.Put("bar", []byte{42})
+		if _, err := NewCompressingDataHandler(inner, nil, Gzip, 0).Get("bar"); err == nil {
+			t.Errorf("Get() should have rejected an unknown algorithm")
+		}
+	})
+	t.Run("Destroy", func(t *testing.T) {
+		inner := NewInMemoryDataHandler()
+		myCache := NewCache(NewCompressingDataHandler(inner, nil, Gzip, 0), nil)
+		recorder := new(removalRecorder)
+		myCache.OnEvict(recorder.record)
+		myCache.Put("foo", "bar")
+		myCache.Destroy()
+		checkRemovals(t, "Destroy", recorder.take(), removalEvent{"foo", "bar", Cleared})
+		if _, err := inner.Get("foo"); !IsValueNotPresentError(err) {
+			t.Errorf("Cacher.Destroy() should have cleared a handler that isn't persistent, got '%v'", err)
+		}
+	})
+}
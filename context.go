@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ContextDataHandler is an optional extension of DataHandler for backends
+// whose operations can be cancelled or given a deadline, such as remote stores.
+// NewCache detects it with a type assertion and passes the context given to
+// Cacher.GetContext, Cacher.PutContext, Cacher.RemoveContext and
+// Cacher.GetOrLoad through. For a plain DataHandler the context is only
+// checked before each call.
+type ContextDataHandler interface {
+	DataHandler
+	// GetContext is DataHandler.Get honoring ctx.
+	GetContext(context.Context, string) (interface{}, error)
+	// PutContext is DataHandler.Put honoring ctx.
+	PutContext(context.Context, string, interface{}) error
+	// RemoveContext is DataHandler.Remove honoring ctx.
+	RemoveContext(context.Context, string) error
+}
+
+// TypedContextDataHandler is the generic counterpart of ContextDataHandler,
+// detected by NewTypedCache.
+type TypedContextDataHandler[K comparable, V any] interface {
+	TypedDataHandler[K, V]
+	// GetContext is TypedDataHandler.Get honoring ctx.
+	GetContext(context.Context, K) (V, error)
+	// PutContext is TypedDataHandler.Put honoring ctx.
+	PutContext(context.Context, K, V) error
+	// RemoveContext is TypedDataHandler.Remove honoring ctx.
+	RemoveContext(context.Context, K) error
+}
+
+// TimeoutError is returned when a context's deadline passes before an
+// operation on the cache finished.
+type TimeoutError struct {
+	Key string // The item key.
+	Err error  // The error from the context or DataHandler.
+}
+
+// Error satisfies the Error interface.
+func (t TimeoutError) Error() string {
+	return fmt.Sprintf("timed out on key '%s': %s", t.Key, t.Err)
+}
+
+// Unwrap returns the underlying error, usually context.DeadlineExceeded.
+func (t TimeoutError) Unwrap() error {
+	return t.Err
+}
+
+// IsTimeoutError is a simple test to determine if an error
+// is of type 'TimeoutError'.
+func IsTimeoutError(err error) bool {
+	_, ok := err.(TimeoutError)
+	return ok
+}
+
+// timeoutError turns a passed deadline into a TimeoutError, any other
+// error is returned as is.
+func timeoutError[K comparable](key K, err error) error {
+	if err == nil || IsTimeoutError(err) || !errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return TimeoutError{
+		Key: keyString(key),
+		Err: err,
+	}
+}
+
+// contextHandler returns handler as a TypedContextDataHandler, checking
+// the context before each call if it doesn't support one itself.
+func contextHandler[K comparable, V any](
+	handler TypedDataHandler[K, V],
+) TypedContextDataHandler[K, V] {
+	if ctxHandler, ok := handler.(TypedContextDataHandler[K, V]); ok {
+		return ctxHandler
+	}
+	return withContext[K, V]{handler}
+}
+
+type withContext[K comparable, V any] struct {
+	TypedDataHandler[K, V]
+}
+
+func (w withContext[K, V]) GetContext(ctx context.Context, key K) (V, error) {
+	if err := ctx.Err(); err != nil {
+		var zero V
+		return zero, err
+	}
+	return w.Get(key)
+}
+
+func (w withContext[K, V]) PutContext(ctx context.Context, key K, val V) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return w.Put(key, val)
+}
+
+func (w withContext[K, V]) RemoveContext(ctx context.Context, key K) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return w.Remove(key)
+}
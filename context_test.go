@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// slowHandler is a ContextDataHandler that takes delay for every call.
+type slowHandler struct {
+	DataHandler
+	delay time.Duration
+	calls int
+}
+
+func (s *slowHandler) wait(ctx context.Context) error {
+	s.calls++
+	select {
+	case <-time.After(s.delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *slowHandler) GetContext(ctx context.Context, key string) (interface{}, error) {
+	if err := s.wait(ctx); err != nil {
+		return nil, err
+	}
+	return s.Get(key)
+}
+
+func (s *slowHandler) PutContext(ctx context.Context, key string, val interface{}) error {
+	if err := s.wait(ctx); err != nil {
+		return err
+	}
+	return s.Put(key, val)
+}
+
+func (s *slowHandler) RemoveContext(ctx context.Context, key string) error {
+	if err := s.wait(ctx); err != nil {
+		return err
+	}
+	return s.Remove(key)
+}
+
+func TestContext(t *testing.T) {
+	handler := &slowHandler{
+		DataHandler: NewInMemoryDataHandler(),
+		delay:       50 * time.Millisecond,
+	}
+	myCache := NewCache(handler, nil)
+	defer myCache.Destroy()
+	if _, err := myCache.Put("foo", "foo"); err != nil {
+		t.Errorf("Cacher.Put() should not have error'd, got '%s'", err)
+	}
+	if handler.calls != 2 {
+		t.Errorf("ContextDataHandler was not used, %d calls", handler.calls)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := myCache.GetContext(ctx, "foo")
+	if !IsTimeoutError(err) {
+		t.Errorf("Cacher.GetContext() should have returned a TimeoutError, got '%v'", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("TimeoutError should unwrap to context.DeadlineExceeded, got '%v'", err)
+	}
+	if _, err = myCache.PutContext(ctx, "foo", "bar"); !IsTimeoutError(err) {
+		t.Errorf("Cacher.PutContext() should have returned a TimeoutError, got '%v'", err)
+	}
+	if _, err = myCache.RemoveContext(ctx, "foo"); !IsTimeoutError(err) {
+		t.Errorf("Cacher.RemoveContext() should have returned a TimeoutError, got '%v'", err)
+	}
+	found, err := myCache.Get("foo")
+	if err != nil || found != "foo" {
+		t.Errorf("timed out calls should not change the cache, got '%#v', '%v'", found, err)
+	}
+
+	plain := NewCache(nil, nil)
+	defer plain.Destroy()
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = plain.PutContext(canceled, "foo", "foo"); err != context.Canceled {
+		t.Errorf("Cacher.PutContext() should have returned context.Canceled, got '%v'", err)
+	}
+	if _, err = plain.Get("foo"); !IsValueNotPresentError(err) {
+		t.Errorf("a canceled put should not insert anything, got '%v'", err)
+	}
+}
@@ -0,0 +1,44 @@
+package cache
+
+import (
+	"fmt"
+)
+
+// CostFunc estimates the cost of holding value at key, used with WithMaxCost.
+type CostFunc func(key string, value interface{}) int64
+
+// DefaultCost is the CostFunc used when WithMaxCost is set without WithCostFunc.
+// []byte and string values cost their length in bytes, anything else costs 1.
+func DefaultCost(key string, value interface{}) int64 {
+	switch v := value.(type) {
+	case []byte:
+		return int64(len(v))
+	case string:
+		return int64(len(v))
+	default:
+		return 1
+	}
+}
+
+// CostExceededError is returned when an item costs more than the whole
+// budget set with WithMaxCost, the item is not stored.
+type CostExceededError struct {
+	Key     string // The item key.
+	Cost    int64  // The cost of the item.
+	MaxCost int64  // The budget of the cache.
+}
+
+// Error satisfies the Error interface.
+func (c CostExceededError) Error() string {
+	return fmt.Sprintf(
+		"cost %d of value for key '%s' exceeds the cache budget of %d",
+		c.Cost, c.Key, c.MaxCost,
+	)
+}
+
+// IsCostExceededError is a simple test to determine if an error
+// is of type 'CostExceededError'.
+func IsCostExceededError(err error) bool {
+	_, ok := err.(CostExceededError)
+	return ok
+}
@@ -0,0 +1,236 @@
+package cache
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// KeyProvider hands out the AES keys an encrypting DataHandler uses. Each
+// key has an ID that is written in the header of every entry encrypted with
+// it, so keys can be rotated while older entries remain readable.
+type KeyProvider interface {
+	// CurrentKey returns the ID and key new entries are encrypted with.
+	CurrentKey() (uint32, []byte, error)
+	// Key returns the key with the ID, for reading entries.
+	Key(uint32) ([]byte, error)
+}
+
+// NewStaticKeyProvider returns a KeyProvider over a fixed set of keys, new
+// entries are encrypted with the key current. Keys must be 16, 24 or 32
+// bytes long for AES-128, AES-192 or AES-256.
+func NewStaticKeyProvider(keys map[uint32][]byte, current uint32) KeyProvider {
+	return staticKeys{
+		keys:    keys,
+		current: current,
+	}
+}
+
+type staticKeys struct {
+	keys    map[uint32][]byte
+	current uint32
+}
+
+func (s staticKeys) CurrentKey() (uint32, []byte, error) {
+	key, err := s.Key(s.current)
+	return s.current, key, err
+}
+
+func (s staticKeys) Key(id uint32) ([]byte, error) {
+	key, ok := s.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("no key with id %d", id)
+	}
+	return key, nil
+}
+
+// IntegrityError is returned when an encrypted entry fails authentication,
+// it was altered, truncated or moved from another key.
+type IntegrityError struct {
+	Key string // The item key.
+	Err error  // The reason the entry was rejected.
+}
+
+// Error satisfies the Error interface.
+func (i IntegrityError) Error() string {
+	return fmt.Sprintf("entry for key '%s' failed its integrity check, %s", i.Key, i.Err)
+}
+
+// Unwrap returns the reason the entry was rejected.
+func (i IntegrityError) Unwrap() error {
+	return i.Err
+}
+
+// IsIntegrityError is a simple test to determine if an error
+// is of type 'IntegrityError'.
+func IsIntegrityError(err error) bool {
+	_, ok := err.(IntegrityError)
+	return ok
+}
+
+// encryptionVersion is the first byte of every encrypted entry, followed by
+// the key ID as a big endian uint32, the nonce and the sealed value.
+const encryptionVersion byte = 1
+
+const encryptionHeaderSize = 1 + 4
+
+// NewEncryptingDataHandler returns a DataHandler that encodes values with
+// EncodeValue and codec, seals them with AES-GCM using a key from keys and
+// stores the result in dataHandler as a []byte. The item key and the
+// entry header are authenticated along with the value, so an entry copied to
+// another key is rejected as well. A nil codec uses GobCodec.
+func NewEncryptingDataHandler(dataHandler DataHandler, codec Codec, keys KeyProvider) DataHandler {
+	if codec == nil {
+		codec = GobCodec{}
+	}
+	return &encrypting{
+		dataHandler: dataHandler,
+		codec:       codec,
+		keys:        keys,
+		aeads:       make(map[string]cipher.AEAD),
+	}
+}
+
+type encrypting struct {
+	dataHandler DataHandler
+	codec       Codec
+	keys        KeyProvider
+	// aeads caches a cipher per key.
+	aeads map[string]cipher.AEAD
+	sync.Mutex
+}
+
+func (e *encrypting) aead(key []byte) (cipher.AEAD, error) {
+	e.Lock()
+	defer e.Unlock()
+	if toRet, ok := e.aeads[string(key)]; ok {
+		return toRet, nil
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	toRet, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	e.aeads[string(key)] = toRet
+	return toRet, nil
+}
+
+func (e *encrypting) Put(key string, data interface{}) error {
+	encoded, err := EncodeValue(e.codec, data)
+	if err != nil {
+		return err
+	}
+	id, secret, err := e.keys.CurrentKey()
+	if err != nil {
+		return err
+	}
+	aead, err := e.aead(secret)
+	if err != nil {
+		return err
+	}
+	size := encryptionHeaderSize + aead.NonceSize()
+	sealed := make([]byte, size, size+len(encoded)+aead.Overhead())
+	sealed[0] = encryptionVersion
+	binary.BigEndian.PutUint32(sealed[1:], id)
+	nonce := sealed[encryptionHeaderSize:size]
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sealed = aead.Seal(sealed, nonce, encoded, additionalData(sealed, key))
+	return e.dataHandler.Put(key, sealed)
+}
+
+// additionalData is what is authenticated along with the value, the entry
+// header and the item key.
+func additionalData(sealed []byte, key string) []byte {
+	toRet := make([]byte, 0, encryptionHeaderSize+len(key))
+	toRet = append(toRet, sealed[:encryptionHeaderSize]...)
+	return append(toRet, key...)
+}
+
+// decode opens an entry read from the wrapped DataHandler.
+func (e *encrypting) decode(key string, stored interface{}) (interface{}, error) {
+	sealed, ok := stored.([]byte)
+	if !ok {
+		return nil, IntegrityError{
+			Key: key,
+			Err: fmt.Errorf("found a %T, not an encrypted entry", stored),
+		}
+	}
+	if len(sealed) < encryptionHeaderSize || sealed[0] != encryptionVersion {
+		return nil, IntegrityError{
+			Key: key,
+			Err: fmt.Errorf("bad header"),
+		}
+	}
+	secret, err := e.keys.Key(binary.BigEndian.Uint32(sealed[1:]))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := e.aead(secret)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < encryptionHeaderSize+aead.NonceSize() {
+		return nil, IntegrityError{
+			Key: key,
+			Err: fmt.Errorf("entry truncated"),
+		}
+	}
+	nonce := sealed[encryptionHeaderSize : encryptionHeaderSize+aead.NonceSize()]
+	encoded, err := aead.Open(nil, nonce, sealed[encryptionHeaderSize+aead.NonceSize():], additionalData(sealed, key))
+	if err != nil {
+		return nil, IntegrityError{
+			Key: key,
+			Err: err,
+		}
+	}
+	return DecodeValue(e.codec, encoded)
+}
+
+func (e *encrypting) Get(key string) (interface{}, error) {
+	stored, err := e.dataHandler.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return e.decode(key, stored)
+}
+
+// Close closes the wrapped DataHandler if it is an io.Closer.
+func (e *encrypting) Close() error {
+	if closer, ok := e.dataHandler.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Persistent reports whether the wrapped DataHandler is persistent.
+func (e *encrypting) Persistent() bool {
+	return persistent(e.dataHandler)
+}
+
+func (e *encrypting) Clear() error {
+	return e.dataHandler.Clear()
+}
+
+func (e *encrypting) Remove(key string) error {
+	return e.dataHandler.Remove(key)
+}
+
+// Range skips entries that cannot be decrypted.
+func (e *encrypting) Range(f func(string, interface{}) bool) {
+	e.dataHandler.Range(func(key string, stored interface{}) bool {
+		val, err := e.decode(key, stored)
+		if err != nil {
+			return true
+		}
+		return f(key, val)
+	})
+}
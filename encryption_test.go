@@ -0,0 +1,68 @@
+package cache
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncryptingDataHandler(t *testing.T) {
+	oldKey := bytes.Repeat([]byte{1}, 32)
+	newKey := bytes.Repeat([]byte{2}, 16)
+	inner := NewInMemoryDataHandler()
+	handler := NewEncryptingDataHandler(inner, nil, NewStaticKeyProvider(map[uint32][]byte{1: oldKey}, 1))
+	myCache := NewCache(handler, nil)
+	defer myCache.Destroy()
+	myCache.Put("foo", "secret")
+	if found, err := myCache.Get("foo"); err != nil || found != "secret" {
+		t.Errorf("Cacher.Get() expected 'secret', got '%#v', '%v'", found, err)
+	}
+	stored, _ := inner.Get("foo")
+	if bytes.Contains(stored.([]byte), []byte("secret")) {
+		t.Errorf("value was stored in the clear")
+	}
+
+	t.Run("rotation", func(t *testing.T) {
+		keys := NewStaticKeyProvider(map[uint32][]byte{1: oldKey, 2: newKey}, 2)
+		rotated := NewEncryptingDataHandler(inner, nil, keys)
+		rotated.Put("bar", []byte("baz"))
+		if found, err := rotated.Get("foo"); err != nil || found.(cacheElement).Value() != "secret" {
+			t.Errorf("Get() expected the entry written with the old key, got '%#v', '%v'", found, err)
+		}
+		if found, err := rotated.Get("bar"); err != nil || string(found.([]byte)) != "baz" {
+			t.Errorf("Get() expected 'baz', got '%#v', '%v'", found, err)
+		}
+		if _, err := handler.Get("bar"); err == nil || IsIntegrityError(err) {
+			t.Errorf("Get() without the new key should fail without an IntegrityError, got '%v'", err)
+		}
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		stored, _ := inner.Get("foo")
+		tampered := append([]byte(nil), stored.([]byte)...)
+		tampered[len(tampered)-1] ^= 1
+		inner.Put("foo", tampered)
+		if _, err := myCache.Get("foo"); !IsIntegrityError(err) {
+			t.Errorf("Cacher.Get() should have returned an IntegrityError, got '%v'", err)
+		}
+		// an intact entry moved to another key
+		inner.Put("moved", stored)
+		if _, err := handler.Get("moved"); !IsIntegrityError(err) {
+			t.Errorf("Get() should have returned an IntegrityError, got '%v'", err)
+		}
+		inner.Put("short", []byte{encryptionVersion})
+		if _, err := handler.Get("short"); !IsIntegrityError(err) {
+			t.Errorf("Get() should have returned an IntegrityError, got '%v'", err)
+		}
+	})
+
+	t.Run("compressed", func(t *testing.T) {
+		// compress before encrypting, ciphertext does not compress
+		arena := NewArenaDataHandler(0, 1, nil)
+		keys := NewStaticKeyProvider(map[uint32][]byte{1: oldKey}, 1)
+		layered := NewCompressingDataHandler(NewEncryptingDataHandler(arena, nil, keys), nil, Gzip, 0)
+		layered.Put("foo", "secret")
+		if found, err := layered.Get("foo"); err != nil || found != "secret" {
+			t.Errorf("Get() expected 'secret', got '%#v', '%v'", found, err)
+		}
+	})
+}
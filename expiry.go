@@ -0,0 +1,128 @@
+package cache
+
+import (
+	"container/heap"
+	"sync"
+)
+
+// expiryQueue is a min-heap of keys ordered by deadline, so the reaper only
+// visits items that are due instead of scanning the whole cache.
+type expiryQueue[K comparable] struct {
+	mu    sync.Mutex
+	items expiryHeap[K]
+	index map[K]*expiryItem[K]
+}
+
+type expiryItem[K comparable] struct {
+	key K
+	// deadline is a Unix time stamp in nanoseconds
+	deadline int64
+	// pos is the position of the item in the heap
+	pos int
+}
+
+func newExpiryQueue[K comparable]() *expiryQueue[K] {
+	return &expiryQueue[K]{
+		index: make(map[K]*expiryItem[K]),
+	}
+}
+
+// schedule sets the deadline of key, replacing any earlier deadline.
+// A deadline <= 0 unschedules key.
+func (e *expiryQueue[K]) schedule(key K, deadline int64) {
+	if deadline <= 0 {
+		e.remove(key)
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if item, ok := e.index[key]; ok {
+		item.deadline = deadline
+		heap.Fix(&e.items, item.pos)
+		return
+	}
+	item := &expiryItem[K]{
+		key:      key,
+		deadline: deadline,
+	}
+	e.index[key] = item
+	heap.Push(&e.items, item)
+}
+
+func (e *expiryQueue[K]) remove(key K) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if item, ok := e.index[key]; ok {
+		heap.Remove(&e.items, item.pos)
+		delete(e.index, key)
+	}
+}
+
+// deadline returns the deadline of key, false if it isn't scheduled.
+func (e *expiryQueue[K]) deadline(key K) (int64, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if item, ok := e.index[key]; ok {
+		return item.deadline, true
+	}
+	return 0, false
+}
+
+// len is the number of scheduled keys.
+func (e *expiryQueue[K]) len() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.items)
+}
+
+// due pops every key whose deadline is at or before now.
+func (e *expiryQueue[K]) due(now int64) []K {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var toRet []K
+	for len(e.items) > 0 && e.items[0].deadline <= now {
+		item := heap.Pop(&e.items).(*expiryItem[K])
+		delete(e.index, item.key)
+		toRet = append(toRet, item.key)
+	}
+	return toRet
+}
+
+func (e *expiryQueue[K]) clear() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.items = nil
+	e.index = make(map[K]*expiryItem[K])
+}
+
+// expiryHeap implements heap.Interface.
+type expiryHeap[K comparable] []*expiryItem[K]
+
+func (h expiryHeap[K]) Len() int {
+	return len(h)
+}
+
+func (h expiryHeap[K]) Less(i, j int) bool {
+	return h[i].deadline < h[j].deadline
+}
+
+func (h expiryHeap[K]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].pos = i
+	h[j].pos = j
+}
+
+func (h *expiryHeap[K]) Push(x interface{}) {
+	item := x.(*expiryItem[K])
+	item.pos = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *expiryHeap[K]) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
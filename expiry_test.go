@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestExpiryQueue(t *testing.T) {
+	queue := newExpiryQueue[string]()
+	queue.schedule("foo", 30)
+	queue.schedule("bar", 10)
+	queue.schedule("baz", 20)
+	queue.schedule("qux", 40)
+	queue.schedule("foo", 5)
+	queue.remove("baz")
+	queue.schedule("qux", 0)
+	due := queue.due(15)
+	if len(due) != 2 || due[0] != "foo" || due[1] != "bar" {
+		t.Errorf("expiryQueue.due() expected [foo bar], got %v", due)
+	}
+	if due = queue.due(100); len(due) != 0 {
+		t.Errorf("expiryQueue.due() should be empty, got %v", due)
+	}
+}
+
+// newBenchCache fills a cache with n items that expire in an hour.
+func newBenchCache(inv Invalidator, n int) *cache[string, interface{}] {
+	myCache := newCache[string, interface{}](
+		dataHandlerAdapter{NewInMemoryDataHandler()}, inv, nil,
+	)
+	for i := 0; i < n; i++ {
+		myCache.PutWithTTL(fmt.Sprintf("foo%d", i), i, time.Hour)
+	}
+	return myCache
+}
+
+// BenchmarkReap measures the cost of a single reaper pass over a large
+// cache where nothing is due, with and without a full scan.
+func BenchmarkReap(b *testing.B) {
+	for _, n := range []int{1000, 100000} {
+		b.Run(fmt.Sprintf("scan=heap/items=%d", n), func(b *testing.B) {
+			myCache := newBenchCache(nil, n)
+			defer myCache.Destroy()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				myCache.reap(time.Now())
+			}
+		})
+		b.Run(fmt.Sprintf("scan=full/items=%d", n), func(b *testing.B) {
+			myCache := newBenchCache(new(dummyInvalidator), n)
+			defer myCache.Destroy()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				myCache.reap(time.Now())
+			}
+		})
+	}
+}
+
+// BenchmarkExpirationLatency measures how long after its deadline an item
+// is removed by the running reaper.
+func BenchmarkExpirationLatency(b *testing.B) {
+	myCache := NewCache(nil, nil)
+	defer myCache.Destroy()
+	removed := make(chan time.Time, 1)
+	myCache.OnEvict(func(string, interface{}, RemovalReason) {
+		removed <- time.Now()
+	})
+	var total time.Duration
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ttl := time.Millisecond
+		deadline := time.Now().Add(ttl)
+		myCache.PutWithTTL("foo", i, ttl)
+		total += (<-removed).Sub(deadline)
+	}
+	b.ReportMetric(float64(total.Milliseconds())/float64(b.N), "ms-late/op")
+}
@@ -1,6 +1,6 @@
 module github.com/buhduh/go-cache
 
-go 1.16
+go 1.18
 
 require (
 	github.com/robertkrimen/godocdown v0.0.0-20130622164427-0bfa04905481 // indirect
@@ -7,53 +7,68 @@ import (
 // NewInMemoryDataHandler returns a Datahandler that is backed with a sync.Map.
 // This is the default DataHandler when nil is passed to NewCache.
 func NewInMemoryDataHandler() DataHandler {
-	return &inMemory{
+	return &inMemory[string, interface{}]{
 		store: new(sync.Map),
 	}
 }
 
-type inMemory struct {
+// NewTypedInMemoryDataHandler returns a TypedDatahandler that is backed with a sync.Map.
+// This is the default TypedDataHandler when nil is passed to NewTypedCache.
+func NewTypedInMemoryDataHandler[K comparable, V any]() TypedDataHandler[K, V] {
+	return &inMemory[K, V]{
+		store: new(sync.Map),
+	}
+}
+
+type inMemory[K comparable, V any] struct {
 	store *sync.Map
 }
 
-func (i *inMemory) Put(key string, data interface{}) error {
+func (i *inMemory[K, V]) Put(key K, data V) error {
 	i.store.Store(key, data)
 	return nil
 }
 
 //Must throw a ValueNotPresentError and be nil
-func (i *inMemory) Get(key string) (interface{}, error) {
+func (i *inMemory[K, V]) Get(key K) (V, error) {
 	toRet, ok := i.store.Load(key)
 	if !ok {
-		return nil, ValueNotPresentError{
-			Key: key,
+		var zero V
+		return zero, ValueNotPresentError{
+			Key: keyString(key),
 		}
 	}
-	return toRet, nil
+	val, _ := toRet.(V)
+	return val, nil
 }
 
-func (i *inMemory) Clear() error {
-	//TODO, does this leak memory?
-	i.store = new(sync.Map)
+// Clear deletes in place, swapping the map would race with concurrent
+// calls such as background reloads.
+func (i *inMemory[K, V]) Clear() error {
+	i.store.Range(func(key, _ interface{}) bool {
+		i.store.Delete(key)
+		return true
+	})
 	return nil
 }
 
 //Must throw a ValueNotPresentError
 //slightly less optimized, but the API is simpler, not sure if this is the
 //right approach
-func (i *inMemory) Remove(key string) error {
+func (i *inMemory[K, V]) Remove(key K) error {
 	_, ok := i.store.LoadAndDelete(key)
 	if !ok {
 		return ValueNotPresentError{
-			Key: key,
+			Key: keyString(key),
 		}
 	}
 	return nil
 }
 
-func (i *inMemory) Range(f func(string, interface{}) bool) {
+func (i *inMemory[K, V]) Range(f func(K, V) bool) {
 	cb := func(iKey interface{}, val interface{}) bool {
-		return f(iKey.(string), val)
+		tVal, _ := val.(V)
+		return f(iKey.(K), tVal)
 	}
 	i.store.Range(cb)
 }
@@ -0,0 +1,57 @@
+package cache
+
+import (
+	"sync"
+)
+
+// keyLockStripes is the number of mutexes keyLocks spreads keys over.
+const keyLockStripes = 64
+
+// keyLocks serializes the calls that read an item and then write it back,
+// so two calls on the same key can't both find it missing and insert it,
+// or one write back an item the other just removed. Keys are striped over
+// a fixed set of mutexes so memory doesn't grow with the keys. Nothing
+// calling out of the cache, such as a removal listener, may run while a
+// key is locked.
+type keyLocks[K comparable] struct {
+	stripes [keyLockStripes]sync.Mutex
+}
+
+// stripe hashes key with 32 bit FNV-1a.
+func (k *keyLocks[K]) stripe(key K) int {
+	sKey := keyString(key)
+	hash := uint32(2166136261)
+	for i := 0; i < len(sKey); i++ {
+		hash ^= uint32(sKey[i])
+		hash *= 16777619
+	}
+	return int(hash % keyLockStripes)
+}
+
+// lock locks key, returning the func unlocking it.
+func (k *keyLocks[K]) lock(key K) func() {
+	mu := &k.stripes[k.stripe(key)]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// lockMany locks every key in keys, in stripe order so calls locking
+// overlapping keys can't deadlock, returning the func unlocking them.
+func (k *keyLocks[K]) lockMany(keys []K) func() {
+	var held [keyLockStripes]bool
+	for _, key := range keys {
+		held[k.stripe(key)] = true
+	}
+	for i := range held {
+		if held[i] {
+			k.stripes[i].Lock()
+		}
+	}
+	return func() {
+		for i := range held {
+			if held[i] {
+				k.stripes[i].Unlock()
+			}
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Loader computes the value for a key missing from the cache, see
+// Cache.GetOrLoad.
+type Loader[V any] func(context.Context) (V, error)
+
+// LoaderPanicError is returned to the callers sharing a run of a Loader
+// that panicked, the caller that started the run gets the panic itself.
+type LoaderPanicError struct {
+	Key   string      // The item key.
+	Value interface{} // The value the Loader panicked with.
+}
+
+// Error satisfies the Error interface.
+func (l LoaderPanicError) Error() string {
+	return fmt.Sprintf("loader for key '%s' panicked: %v", l.Key, l.Value)
+}
+
+// IsLoaderPanicError is a simple test to determine if an error
+// is of type 'LoaderPanicError'.
+func IsLoaderPanicError(err error) bool {
+	_, ok := err.(LoaderPanicError)
+	return ok
+}
+
+// loadCall is a single in flight run of a Loader, shared by every caller
+// waiting on the same key.
+type loadCall[V any] struct {
+	done chan int8
+	val  V
+	err  error
+	// waiters is the number of callers still waiting, the run's context is
+	// cancelled once it drops to 0.
+	waiters int
+	cancel  context.CancelFunc
+	// panicked is set if the Loader panicked with recovered.
+	panicked  bool
+	recovered interface{}
+}
+
+type loadError struct {
+	err     error
+	expires time.Time
+}
+
+// detachedContext keeps the values of a context but none of its
+// cancellation, so a run shared by many callers doesn't end with the first.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+// loadGroup coalesces concurrent loads of the same key so a Loader runs once
+// per key at a time.
+type loadGroup[K comparable, V any] struct {
+	mu       sync.Mutex
+	calls    map[K]*loadCall[V]
+	errs     map[K]loadError
+	errorTTL time.Duration
+}
+
+func newLoadGroup[K comparable, V any](errorTTL time.Duration) *loadGroup[K, V] {
+	return &loadGroup[K, V]{
+		calls:    make(map[K]*loadCall[V]),
+		errs:     make(map[K]loadError),
+		errorTTL: errorTTL,
+	}
+}
+
+// do runs fn for key unless a run is already in flight, in which case it
+// waits for that run's result. fn runs on its own goroutine with a context
+// carrying the values of the ctx that started the run, cancelled once every
+// caller's ctx is done, so each caller returns at its own deadline. If fn
+// panics, the caller that started the run panics too if it is still
+// waiting and the others get a LoaderPanicError.
+func (l *loadGroup[K, V]) do(ctx context.Context, key K, fn Loader[V]) (V, error) {
+	var zero V
+	l.mu.Lock()
+	if cached, ok := l.errs[key]; ok {
+		if time.Now().Before(cached.expires) {
+			l.mu.Unlock()
+			return zero, cached.err
+		}
+		delete(l.errs, key)
+	}
+	call, joined := l.calls[key]
+	if joined {
+		call.waiters++
+	} else {
+		runCtx, cancel := context.WithCancel(detachedContext{ctx})
+		call = &loadCall[V]{
+			done:    make(chan int8),
+			waiters: 1,
+			cancel:  cancel,
+		}
+		l.calls[key] = call
+		go l.run(runCtx, key, call, fn)
+	}
+	l.mu.Unlock()
+	select {
+	case <-call.done:
+		if call.panicked && !joined {
+			panic(call.recovered)
+		}
+		return call.val, call.err
+	case <-ctx.Done():
+		l.leave(key, call)
+		return zero, ctx.Err()
+	}
+}
+
+// run calls fn for call and hands its result to the callers waiting on it.
+func (l *loadGroup[K, V]) run(ctx context.Context, key K, call *loadCall[V], fn Loader[V]) {
+	call.panicked = true
+	defer func() {
+		if call.panicked {
+			call.recovered = recover()
+			call.err = LoaderPanicError{
+				Key:   keyString(key),
+				Value: call.recovered,
+			}
+		}
+		l.mu.Lock()
+		// a run every caller left was already dropped, and maybe replaced
+		if l.calls[key] == call {
+			delete(l.calls, key)
+			// negative cache hits are cached by the cache itself
+			if call.err != nil && l.errorTTL > 0 && !call.panicked && !IsNegativeCacheHitError(call.err) {
+				l.errs[key] = loadError{
+					err:     call.err,
+					expires: time.Now().Add(l.errorTTL),
+				}
+			}
+		}
+		l.mu.Unlock()
+		call.cancel()
+		close(call.done)
+	}()
+	call.val, call.err = fn(ctx)
+	call.panicked = false
+}
+
+// leave drops a caller that stopped waiting on call. Once the last caller
+// has left the run is cancelled and dropped, so later callers start a new
+// one.
+func (l *loadGroup[K, V]) leave(key K, call *loadCall[V]) {
+	l.mu.Lock()
+	call.waiters--
+	if call.waiters == 0 {
+		call.cancel()
+		if l.calls[key] == call {
+			delete(l.calls, key)
+		}
+	}
+	l.mu.Unlock()
+}
+
+// clear drops every cached loader error.
+func (l *loadGroup[K, V]) clear() {
+	l.mu.Lock()
+	l.errs = make(map[K]loadError)
+	l.mu.Unlock()
+}
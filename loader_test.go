@@ -0,0 +1,217 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetOrLoad(t *testing.T) {
+	t.Run("mechanic=Coalesce", testLoadCoalesce)
+	t.Run("mechanic=Errors", testLoadErrors)
+	t.Run("mechanic=CachedErrors", testLoadCachedErrors)
+	t.Run("mechanic=Panic", testLoadPanic)
+	t.Run("mechanic=Cancel", testLoadCancel)
+}
+
+func testLoadCoalesce(t *testing.T) {
+	myCache := NewCache(nil, nil)
+	defer myCache.Destroy()
+	var calls int32
+	release := make(chan int8)
+	loader := func(context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "bar", nil
+	}
+	var wg sync.WaitGroup
+	results := make([]interface{}, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = myCache.GetOrLoad(context.Background(), "foo", loader)
+		}(i)
+	}
+	dur, _ := time.ParseDuration("50ms")
+	time.Sleep(dur)
+	close(release)
+	wg.Wait()
+	if calls != 1 {
+		t.Errorf("loader should have run once, ran %d times", calls)
+	}
+	for i, res := range results {
+		if res != "bar" {
+			t.Errorf("result %d expected '%s', got '%#v'", i, "bar", res)
+		}
+	}
+	found, err := myCache.Get("foo")
+	if err != nil || found != "bar" {
+		t.Errorf("Cacher.GetOrLoad() did not insert the loaded value, got '%#v', '%v'", found, err)
+	}
+}
+
+func testLoadErrors(t *testing.T) {
+	myCache := NewCache(nil, nil)
+	defer myCache.Destroy()
+	var calls int32
+	loadErr := errors.New("load failed")
+	loader := func(context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, loadErr
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := myCache.GetOrLoad(context.Background(), "foo", loader); err != loadErr {
+			t.Errorf("Cacher.GetOrLoad() expected '%s', got '%v'", loadErr, err)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("errors should not be cached, loader ran %d times", calls)
+	}
+	if _, err := myCache.Get("foo"); !IsValueNotPresentError(err) {
+		t.Errorf("a failed load should not insert anything, got '%v'", err)
+	}
+}
+
+func testLoadCachedErrors(t *testing.T) {
+	lifetime, _ := time.ParseDuration("100ms")
+	myCache := NewCache(nil, nil, WithLoaderErrorCaching(lifetime))
+	defer myCache.Destroy()
+	var calls int32
+	loadErr := errors.New("load failed")
+	loader := func(context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, loadErr
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := myCache.GetOrLoad(context.Background(), "foo", loader); err != loadErr {
+			t.Errorf("Cacher.GetOrLoad() expected '%s', got '%v'", loadErr, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("error should have been cached, loader ran %d times", calls)
+	}
+	time.Sleep(2 * lifetime)
+	myCache.GetOrLoad(context.Background(), "foo", loader)
+	if calls != 2 {
+		t.Errorf("cached error should have expired, loader ran %d times", calls)
+	}
+}
+
+func testLoadPanic(t *testing.T) {
+	myCache := NewCache(nil, nil)
+	defer myCache.Destroy()
+	started := make(chan int8)
+	release := make(chan int8)
+	loader := func(context.Context) (interface{}, error) {
+		close(started)
+		<-release
+		panic("load failed")
+	}
+	recovered := make(chan interface{})
+	go func() {
+		defer func() {
+			recovered <- recover()
+		}()
+		myCache.GetOrLoad(context.Background(), "foo", loader)
+	}()
+	<-started
+	waited := make(chan error)
+	go func() {
+		_, err := myCache.GetOrLoad(context.Background(), "foo", loader)
+		waited <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	if r := <-recovered; r != "load failed" {
+		t.Errorf("Cacher.GetOrLoad() should have panicked with '%s', got '%#v'", "load failed", r)
+	}
+	if err := <-waited; !IsLoaderPanicError(err) {
+		t.Errorf("Cacher.GetOrLoad() expected a LoaderPanicError, got '%v'", err)
+	}
+	found, err := myCache.GetOrLoad(context.Background(), "foo", func(context.Context) (interface{}, error) {
+		return "bar", nil
+	})
+	if err != nil || found != "bar" {
+		t.Errorf("Cacher.GetOrLoad() expected 'bar' after a panic, got '%#v', '%v'", found, err)
+	}
+}
+
+func testLoadCancel(t *testing.T) {
+	myCache := NewCache(nil, nil)
+	defer myCache.Destroy()
+	started := make(chan int8)
+	release := make(chan int8)
+	var loadErr error
+	loader := func(ctx context.Context) (interface{}, error) {
+		close(started)
+		select {
+		case <-release:
+			return "bar", nil
+		case <-ctx.Done():
+			loadErr = ctx.Err()
+			return nil, loadErr
+		}
+	}
+	first, cancelFirst := context.WithCancel(context.Background())
+	go myCache.GetOrLoad(first, "foo", loader)
+	<-started
+	second, cancelSecond := context.WithCancel(context.Background())
+	defer cancelSecond()
+	waited := make(chan interface{})
+	go func() {
+		found, _ := myCache.GetOrLoad(second, "foo", loader)
+		waited <- found
+	}()
+	time.Sleep(10 * time.Millisecond)
+	// the run goes on for the second caller
+	cancelFirst()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	if found := <-waited; found != "bar" {
+		t.Errorf("Cacher.GetOrLoad() expected 'bar' after the first caller left, got '%#v'", found)
+	}
+
+	myCache.Clear()
+	loadErrs := make(chan error, 1)
+	blocked := func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		loadErrs <- ctx.Err()
+		return nil, ctx.Err()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := myCache.GetOrLoad(ctx, "foo", blocked)
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Cacher.GetOrLoad() expected '%s', got '%v'", context.Canceled, err)
+	}
+	if err := <-loadErrs; !errors.Is(err, context.Canceled) {
+		t.Errorf("the run should be cancelled once every caller left, got '%v'", err)
+	}
+	// a later call starts a new run rather than joining the cancelled one
+	found, err := myCache.GetOrLoad(context.Background(), "foo", func(context.Context) (interface{}, error) {
+		return "bar", nil
+	})
+	if err != nil || found != "bar" {
+		t.Errorf("Cacher.GetOrLoad() expected 'bar' from a new run, got '%#v', '%v'", found, err)
+	}
+
+	timeout, _ := time.ParseDuration("20ms")
+	ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	start := time.Now()
+	if _, err := myCache.GetOrLoad(ctx, "bar", blocked); !IsTimeoutError(err) {
+		t.Errorf("Cacher.GetOrLoad() expected a TimeoutError, got '%v'", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*timeout {
+		t.Errorf("the call starting a run should return at its own deadline, took %v", elapsed)
+	}
+}
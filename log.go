@@ -0,0 +1,541 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// LogDataHandler is a DataHandler persisted to an append only log of
+// segment files, it must be closed to release them.
+type LogDataHandler interface {
+	LenDataHandler
+	PersistentDataHandler
+	// Compact copies the items still live in every segment but the one
+	// being written to into that one, then deletes the older segments.
+	// It also runs in the background whenever a segment fills up and more
+	// than half of the older segments is dead.
+	Compact() error
+}
+
+// Each record in a segment is a CRC-32 of the rest of the record, the length
+// of the body, then the body: an op, the key length, the key and for logPut
+// the value written by EncodeValue. All integers are big endian uint32s.
+const (
+	logPut byte = iota + 1
+	logRemove
+	// logClear drops everything in the segments before it.
+	logClear
+)
+
+const (
+	logHeaderSize = 4 + 4
+	logBodySize   = 1 + 4
+	logSuffix     = ".seg"
+)
+
+// NewLogDataHandler opens, or creates, a LogDataHandler in dir, replaying
+// its segments to rebuild the index. Values are encoded with codec, a nil
+// codec uses GobCodec. A new segment is started once the current one
+// reaches maxSegment bytes, maxSegment < 1 defaults to 64MiB. A record cut
+// short at the end of the last segment, as left by a crash, is truncated.
+func NewLogDataHandler(dir string, codec Codec, maxSegment int64) (LogDataHandler, error) {
+	if codec == nil {
+		codec = GobCodec{}
+	}
+	if maxSegment < 1 {
+		maxSegment = 64 << 20
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	toRet := &logHandler{
+		dir:        dir,
+		codec:      codec,
+		maxSegment: maxSegment,
+		index:      make(map[string]logLocation),
+	}
+	if err := toRet.open(); err != nil {
+		toRet.closeSegments()
+		return nil, err
+	}
+	return toRet, nil
+}
+
+type logHandler struct {
+	sync.RWMutex
+	dir        string
+	codec      Codec
+	maxSegment int64
+	// segments is oldest first, the last one is written to
+	segments   []*logSegment
+	index      map[string]logLocation
+	compacting bool
+	closed     bool
+	background sync.WaitGroup
+}
+
+type logSegment struct {
+	seq  uint64
+	file *os.File
+	// size is the bytes written, live those of records in the index
+	size int64
+	live int64
+}
+
+// logLocation is where the latest record for a key is.
+type logLocation struct {
+	seg    *logSegment
+	offset int64
+	size   int64
+}
+
+func (l *logHandler) segmentPath(seq uint64) string {
+	return filepath.Join(l.dir, fmt.Sprintf("%016x%s", seq, logSuffix))
+}
+
+func (l *logHandler) open() error {
+	entries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return err
+	}
+	var seqs []uint64
+	for _, entry := range entries {
+		var seq uint64
+		if !strings.HasSuffix(entry.Name(), logSuffix) {
+			continue
+		}
+		if _, err := fmt.Sscanf(entry.Name(), "%016x"+logSuffix, &seq); err == nil {
+			seqs = append(seqs, seq)
+		}
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	for i, seq := range seqs {
+		file, err := os.OpenFile(l.segmentPath(seq), os.O_RDWR, 0600)
+		if err != nil {
+			return err
+		}
+		seg := &logSegment{
+			seq:  seq,
+			file: file,
+		}
+		l.segments = append(l.segments, seg)
+		if err := l.replay(seg, i == len(seqs)-1); err != nil {
+			return err
+		}
+	}
+	if len(l.segments) == 0 {
+		return l.addSegment(1)
+	}
+	return nil
+}
+
+// replay applies the records in seg to the index. A damaged record ends the
+// last segment, anywhere else it is an error.
+func (l *logHandler) replay(seg *logSegment, last bool) error {
+	r := bufio.NewReader(seg.file)
+	var offset int64
+	for {
+		record, err := readRecord(r)
+		if err == io.EOF {
+			break
+		}
+		var op byte
+		var key string
+		if err == nil {
+			op, key, _, err = parseRecord(record)
+		}
+		if err != nil {
+			if !last {
+				return fmt.Errorf("segment %s is damaged at %d, %w", seg.file.Name(), offset, err)
+			}
+			if err := seg.file.Truncate(offset); err != nil {
+				return err
+			}
+			break
+		}
+		loc := logLocation{
+			seg:    seg,
+			offset: offset,
+			size:   int64(len(record)),
+		}
+		switch op {
+		case logPut:
+			l.index[key] = l.moved(key, loc)
+		case logRemove:
+			l.moved(key, logLocation{})
+			delete(l.index, key)
+		case logClear:
+			l.index = make(map[string]logLocation)
+			for _, s := range l.segments {
+				s.live = 0
+			}
+		}
+		offset += loc.size
+	}
+	seg.size = offset
+	_, err := seg.file.Seek(offset, io.SeekStart)
+	return err
+}
+
+// moved accounts for key's latest record now being at loc, loc has no
+// segment when key was removed.
+func (l *logHandler) moved(key string, loc logLocation) logLocation {
+	if old, ok := l.index[key]; ok {
+		old.seg.live -= old.size
+	}
+	if loc.seg != nil {
+		loc.seg.live += loc.size
+	}
+	return loc
+}
+
+// readRecord reads a whole record, checking its CRC.
+func readRecord(r io.Reader) ([]byte, error) {
+	header := make([]byte, logHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("record header cut short")
+		}
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(header[4:])
+	if size < logBodySize {
+		return nil, fmt.Errorf("record of %d bytes is too short", size)
+	}
+	record := make([]byte, logHeaderSize+int(size))
+	copy(record, header)
+	if _, err := io.ReadFull(r, record[logHeaderSize:]); err != nil {
+		return nil, fmt.Errorf("record cut short, %w", err)
+	}
+	if err := checkRecord(record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func checkRecord(record []byte) error {
+	if crc32.ChecksumIEEE(record[4:]) != binary.BigEndian.Uint32(record) {
+		return fmt.Errorf("record checksum mismatch")
+	}
+	return nil
+}
+
+// parseRecord splits a checked record into its op, key and value.
+func parseRecord(record []byte) (byte, string, []byte, error) {
+	body := record[logHeaderSize:]
+	keyLen := binary.BigEndian.Uint32(body[1:])
+	if uint64(keyLen) > uint64(len(body)-logBodySize) {
+		return 0, "", nil, fmt.Errorf("record key of %d bytes overruns the record", keyLen)
+	}
+	key := body[logBodySize : logBodySize+keyLen]
+	return body[0], string(key), body[logBodySize+keyLen:], nil
+}
+
+func newRecord(op byte, key string, val []byte) []byte {
+	size := logBodySize + len(key) + len(val)
+	record := make([]byte, logHeaderSize, logHeaderSize+size)
+	binary.BigEndian.PutUint32(record[4:], uint32(size))
+	record = append(record, op, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(record[logHeaderSize+1:], uint32(len(key)))
+	record = append(record, key...)
+	record = append(record, val...)
+	binary.BigEndian.PutUint32(record, crc32.ChecksumIEEE(record[4:]))
+	return record
+}
+
+func (l *logHandler) addSegment(seq uint64) error {
+	file, err := os.OpenFile(l.segmentPath(seq), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	l.segments = append(l.segments, &logSegment{
+		seq:  seq,
+		file: file,
+	})
+	return nil
+}
+
+func (l *logHandler) active() *logSegment {
+	return l.segments[len(l.segments)-1]
+}
+
+// write appends record to the active segment, starting a new one when it
+// is full.
+func (l *logHandler) write(record []byte) (logLocation, error) {
+	if l.closed {
+		return logLocation{}, fmt.Errorf("log in %s is closed", l.dir)
+	}
+	seg := l.active()
+	if seg.size > 0 && seg.size+int64(len(record)) > l.maxSegment {
+		if err := l.addSegment(seg.seq + 1); err != nil {
+			return logLocation{}, err
+		}
+		seg = l.active()
+		l.maybeCompact()
+	}
+	if _, err := seg.file.Write(record); err != nil {
+		// drop whatever part of record was written, the segment must end at
+		// seg.size for the next write
+		if rollback := seg.file.Truncate(seg.size); rollback != nil {
+			return logLocation{}, fmt.Errorf("%w, then failed to drop the partial record, %v", err, rollback)
+		}
+		if _, rollback := seg.file.Seek(seg.size, io.SeekStart); rollback != nil {
+			return logLocation{}, fmt.Errorf("%w, then failed to drop the partial record, %v", err, rollback)
+		}
+		return logLocation{}, err
+	}
+	loc := logLocation{
+		seg:    seg,
+		offset: seg.size,
+		size:   int64(len(record)),
+	}
+	seg.size += loc.size
+	return loc, nil
+}
+
+// maybeCompact starts a background compaction if over half of the sealed
+// segments is dead.
+func (l *logHandler) maybeCompact() {
+	if l.compacting {
+		return
+	}
+	var size, live int64
+	for _, seg := range l.segments[:len(l.segments)-1] {
+		size += seg.size
+		live += seg.live
+	}
+	if live*2 >= size {
+		return
+	}
+	l.compacting = true
+	l.background.Add(1)
+	go func() {
+		defer l.background.Done()
+		l.Lock()
+		defer l.Unlock()
+		if !l.closed {
+			l.compact()
+		}
+		l.compacting = false
+	}()
+}
+
+func (l *logHandler) Compact() error {
+	l.Lock()
+	defer l.Unlock()
+	if l.closed {
+		return fmt.Errorf("log in %s is closed", l.dir)
+	}
+	compacting := l.compacting
+	l.compacting = true
+	err := l.compact()
+	l.compacting = compacting
+	return err
+}
+
+func (l *logHandler) compact() error {
+	old := make(map[*logSegment]bool)
+	for _, seg := range l.segments[:len(l.segments)-1] {
+		old[seg] = true
+	}
+	if len(old) == 0 {
+		return nil
+	}
+	for key, loc := range l.index {
+		if !old[loc.seg] {
+			continue
+		}
+		record, err := l.read(loc)
+		if err != nil {
+			return err
+		}
+		moved, err := l.write(record)
+		if err != nil {
+			return err
+		}
+		l.index[key] = l.moved(key, moved)
+	}
+	return l.drop(old)
+}
+
+// drop deletes the segments in old once the others, holding whatever was
+// copied out of old, are synced.
+func (l *logHandler) drop(old map[*logSegment]bool) error {
+	for _, seg := range l.segments {
+		if old[seg] {
+			continue
+		}
+		if err := seg.file.Sync(); err != nil {
+			return err
+		}
+	}
+	var errs []error
+	kept := l.segments[:0]
+	for _, seg := range l.segments {
+		if !old[seg] {
+			kept = append(kept, seg)
+			continue
+		}
+		errs = append(errs, seg.file.Close(), os.Remove(seg.file.Name()))
+	}
+	l.segments = kept
+	return firstError(errs)
+}
+
+func (l *logHandler) read(loc logLocation) ([]byte, error) {
+	record := make([]byte, loc.size)
+	if _, err := loc.seg.file.ReadAt(record, loc.offset); err != nil {
+		return nil, err
+	}
+	return record, checkRecord(record)
+}
+
+func (l *logHandler) Put(key string, data interface{}) error {
+	val, err := EncodeValue(l.codec, data)
+	if err != nil {
+		return err
+	}
+	record := newRecord(logPut, key, val)
+	l.Lock()
+	defer l.Unlock()
+	loc, err := l.write(record)
+	if err != nil {
+		return err
+	}
+	l.index[key] = l.moved(key, loc)
+	return nil
+}
+
+func (l *logHandler) Get(key string) (interface{}, error) {
+	l.RLock()
+	loc, ok := l.index[key]
+	var record []byte
+	var err error
+	if ok {
+		record, err = l.read(loc)
+	}
+	l.RUnlock()
+	if !ok {
+		return nil, ValueNotPresentError{
+			Key: key,
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	_, _, val, err := parseRecord(record)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeValue(l.codec, val)
+}
+
+// Clear starts a fresh segment beginning with a clear record and deletes
+// the older ones.
+func (l *logHandler) Clear() error {
+	l.Lock()
+	defer l.Unlock()
+	if l.closed {
+		return fmt.Errorf("log in %s is closed", l.dir)
+	}
+	old := make(map[*logSegment]bool)
+	for _, seg := range l.segments {
+		old[seg] = true
+	}
+	if err := l.addSegment(l.active().seq + 1); err != nil {
+		return err
+	}
+	if _, err := l.write(newRecord(logClear, "", nil)); err != nil {
+		return err
+	}
+	l.index = make(map[string]logLocation)
+	return l.drop(old)
+}
+
+func (l *logHandler) Remove(key string) error {
+	l.Lock()
+	defer l.Unlock()
+	if _, ok := l.index[key]; !ok {
+		return ValueNotPresentError{
+			Key: key,
+		}
+	}
+	if _, err := l.write(newRecord(logRemove, key, nil)); err != nil {
+		return err
+	}
+	l.moved(key, logLocation{})
+	delete(l.index, key)
+	return nil
+}
+
+// Range walks a snapshot of the index, so f is free to modify the cache.
+// Items that cannot be read are skipped.
+func (l *logHandler) Range(f func(string, interface{}) bool) {
+	l.RLock()
+	keys := make([]string, 0, len(l.index))
+	for key := range l.index {
+		keys = append(keys, key)
+	}
+	l.RUnlock()
+	for _, key := range keys {
+		val, err := l.Get(key)
+		if err != nil {
+			continue
+		}
+		if !f(key, val) {
+			return
+		}
+	}
+}
+
+func (l *logHandler) Len() int {
+	l.RLock()
+	defer l.RUnlock()
+	return len(l.index)
+}
+
+// Persistent is always true, the log outlives the cache.
+func (l *logHandler) Persistent() bool {
+	return true
+}
+
+// Close waits for a background compaction to finish, then syncs and closes
+// the segments.
+func (l *logHandler) Close() error {
+	l.Lock()
+	if l.closed {
+		l.Unlock()
+		return nil
+	}
+	l.closed = true
+	l.Unlock()
+	l.background.Wait()
+	l.Lock()
+	defer l.Unlock()
+	return l.closeSegments()
+}
+
+func (l *logHandler) closeSegments() error {
+	var errs []error
+	for _, seg := range l.segments {
+		errs = append(errs, seg.file.Sync(), seg.file.Close())
+	}
+	return firstError(errs)
+}
+
+func firstError(errs []error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package cache
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func segmentCount(t *testing.T, dir string) int {
+	matches, err := filepath.Glob(filepath.Join(dir, "*"+logSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(matches)
+}
+
+func TestLogDataHandler(t *testing.T) {
+	t.Run("reopen", func(t *testing.T) {
+		dir := t.TempDir()
+		handler, err := NewLogDataHandler(dir, nil, 0)
+		if err != nil {
+			t.Fatalf("NewLogDataHandler() returned an error, %v", err)
+		}
+		myCache := NewCache(handler, NewTimedInvalidator(time.Hour))
+		for i := 0; i < 10; i++ {
+			myCache.Put(fmt.Sprintf("foo%d", i), i)
+		}
+		myCache.PutWithTTL("ttl", "bar", time.Hour)
+		myCache.Remove("foo0")
+		myCache.Destroy()
+
+		handler, err = NewLogDataHandler(dir, nil, 0)
+		if err != nil {
+			t.Fatalf("NewLogDataHandler() returned an error, %v", err)
+		}
+		myCache = NewCache(handler, NewTimedInvalidator(time.Hour))
+		defer myCache.Destroy()
+		if handler.Len() != 10 || myCache.Stats().Entries != 10 {
+			t.Errorf("expected %d items after reopening, got %d, %d entries", 10, handler.Len(), myCache.Stats().Entries)
+		}
+		if _, err := myCache.Get("foo0"); !IsValueNotPresentError(err) {
+			t.Errorf("Cacher.Get() should have returned a ValueNotPresentError, got '%v'", err)
+		}
+		for i := 1; i < 10; i++ {
+			if found, err := myCache.Get(fmt.Sprintf("foo%d", i)); err != nil || found != i {
+				t.Errorf("Cacher.Get() expected %d, got '%#v', '%v'", i, found, err)
+			}
+		}
+		stored, _ := handler.Get("ttl")
+		if stored.(cacheElement).Metadata().Expires == 0 {
+			t.Errorf("reopening lost the item's metadata")
+		}
+	})
+
+	t.Run("Clear", func(t *testing.T) {
+		dir := t.TempDir()
+		handler, _ := NewLogDataHandler(dir, nil, 0)
+		handler.Put("foo", []byte("bar"))
+		handler.Clear()
+		handler.Put("baz", []byte("qux"))
+		handler.Close()
+		if segmentCount(t, dir) != 1 {
+			t.Errorf("Clear() should have left %d segment, found %d", 1, segmentCount(t, dir))
+		}
+		handler, _ = NewLogDataHandler(dir, nil, 0)
+		defer handler.Close()
+		if _, err := handler.Get("foo"); !IsValueNotPresentError(err) {
+			t.Errorf("Get() should have returned a ValueNotPresentError, got '%v'", err)
+		}
+		if handler.Len() != 1 {
+			t.Errorf("Len() expected %d, got %d", 1, handler.Len())
+		}
+	})
+
+	t.Run("Compact", func(t *testing.T) {
+		dir := t.TempDir()
+		handler, _ := NewLogDataHandler(dir, nil, 256)
+		for i := 0; i < 100; i++ {
+			handler.Put(fmt.Sprintf("foo%d", i%5), []byte(fmt.Sprintf("bar%d", i)))
+		}
+		if err := handler.Compact(); err != nil {
+			t.Fatalf("Compact() returned an error, %v", err)
+		}
+		if segmentCount(t, dir) > 2 {
+			t.Errorf("Compact() left %d segments", segmentCount(t, dir))
+		}
+		handler.Close()
+		handler, _ = NewLogDataHandler(dir, nil, 256)
+		defer handler.Close()
+		for i := 95; i < 100; i++ {
+			key := fmt.Sprintf("foo%d", i%5)
+			if found, err := handler.Get(key); err != nil || string(found.([]byte)) != fmt.Sprintf("bar%d", i) {
+				t.Errorf("Get() expected 'bar%d', got '%#v', '%v'", i, found, err)
+			}
+		}
+	})
+
+	t.Run("damaged", func(t *testing.T) {
+		dir := t.TempDir()
+		handler, _ := NewLogDataHandler(dir, nil, 0)
+		handler.Put("foo", []byte("bar"))
+		handler.Put("baz", []byte("qux"))
+		handler.Close()
+		// a crash while writing the last record
+		path := filepath.Join(dir, fmt.Sprintf("%016x%s", 1, logSuffix))
+		info, _ := os.Stat(path)
+		os.Truncate(path, info.Size()-2)
+		handler, err := NewLogDataHandler(dir, nil, 0)
+		if err != nil {
+			t.Fatalf("NewLogDataHandler() returned an error, %v", err)
+		}
+		defer handler.Close()
+		if handler.Len() != 1 {
+			t.Errorf("Len() expected %d, got %d", 1, handler.Len())
+		}
+		handler.Put("baz", []byte("qux"))
+		if found, err := handler.Get("baz"); err != nil || string(found.([]byte)) != "qux" {
+			t.Errorf("Get() expected 'qux', got '%#v', '%v'", found, err)
+		}
+	})
+
+	t.Run("badKey", func(t *testing.T) {
+		dir := t.TempDir()
+		handler, _ := NewLogDataHandler(dir, nil, 0)
+		handler.Put("foo", []byte("bar"))
+		handler.Close()
+		// a record whose checksum holds but whose key runs past its end
+		record := newRecord(logPut, "baz", []byte("qux"))
+		binary.BigEndian.PutUint32(record[logHeaderSize+1:], 1<<20)
+		binary.BigEndian.PutUint32(record, crc32.ChecksumIEEE(record[4:]))
+		path := filepath.Join(dir, fmt.Sprintf("%016x%s", 1, logSuffix))
+		file, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+		file.Write(record)
+		file.Close()
+		handler, err := NewLogDataHandler(dir, nil, 0)
+		if err != nil {
+			t.Fatalf("NewLogDataHandler() returned an error, %v", err)
+		}
+		defer handler.Close()
+		if handler.Len() != 1 {
+			t.Errorf("Len() expected %d, got %d", 1, handler.Len())
+		}
+		if found, err := handler.Get("foo"); err != nil || string(found.([]byte)) != "bar" {
+			t.Errorf("Get() expected 'bar', got '%#v', '%v'", found, err)
+		}
+	})
+}
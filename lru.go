@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// lru orders keys from most to least recently used so a capacity bounded
+// cache knows what to evict. It is touched alongside the metadataHelper
+// calls that record Created, Accessed and Modified. A nil *lru is a cache
+// without a capacity, all of its methods are no-ops.
+type lru[K comparable] struct {
+	mu         sync.Mutex
+	order      *list.List
+	elements   map[K]*list.Element
+	maxEntries int
+	maxCost    int64
+	cost       int64
+}
+
+type lruEntry[K comparable] struct {
+	key  K
+	cost int64
+}
+
+func newLRU[K comparable](maxEntries int, maxCost int64) *lru[K] {
+	return &lru[K]{
+		order:      list.New(),
+		elements:   make(map[K]*list.Element),
+		maxEntries: maxEntries,
+		maxCost:    maxCost,
+	}
+}
+
+// add marks key as the most recently used with a new cost, adding it if it is new.
+func (l *lru[K]) add(key K, cost int64) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if elem, ok := l.elements[key]; ok {
+		entry := elem.Value.(*lruEntry[K])
+		l.cost += cost - entry.cost
+		entry.cost = cost
+		l.order.MoveToFront(elem)
+		return
+	}
+	l.cost += cost
+	l.elements[key] = l.order.PushFront(&lruEntry[K]{
+		key:  key,
+		cost: cost,
+	})
+}
+
+// touch marks key as the most recently used.
+func (l *lru[K]) touch(key K) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if elem, ok := l.elements[key]; ok {
+		l.order.MoveToFront(elem)
+	}
+}
+
+func (l *lru[K]) remove(key K) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if elem, ok := l.elements[key]; ok {
+		l.order.Remove(elem)
+		l.cost -= elem.Value.(*lruEntry[K]).cost
+		delete(l.elements, key)
+	}
+}
+
+// fits reports whether an item of cost could ever be held.
+func (l *lru[K]) fits(cost int64) bool {
+	return l == nil || l.maxCost <= 0 || cost <= l.maxCost
+}
+
+// overflow pops the least recently used key while there are more than
+// maxEntries keys or their cost is over maxCost, ok is false once the lru
+// is within its limits.
+func (l *lru[K]) overflow() (key K, ok bool) {
+	if l == nil {
+		return key, false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	overCount := l.maxEntries > 0 && l.order.Len() > l.maxEntries
+	overCost := l.maxCost > 0 && l.cost > l.maxCost
+	if !overCount && !overCost {
+		return key, false
+	}
+	elem := l.order.Back()
+	l.order.Remove(elem)
+	entry := elem.Value.(*lruEntry[K])
+	l.cost -= entry.cost
+	delete(l.elements, entry.key)
+	return entry.key, true
+}
+
+func (l *lru[K]) clear() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.order.Init()
+	l.elements = make(map[K]*list.Element)
+	l.cost = 0
+}
@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestLRU(t *testing.T) {
+	myCache := NewCache(nil, nil, WithMaxEntries(3))
+	defer myCache.Destroy()
+	for i := 0; i < 3; i++ {
+		myCache.Put(fmt.Sprintf("foo%d", i), i)
+	}
+	// foo0 becomes the most recently used, foo1 the least
+	myCache.Get("foo0")
+	myCache.Put("foo3", 3)
+	if _, err := myCache.Get("foo1"); !IsValueNotPresentError(err) {
+		t.Errorf("least recently used item should have been evicted, got '%v'", err)
+	}
+	for _, key := range []string{"foo0", "foo2", "foo3"} {
+		if _, err := myCache.Get(key); err != nil {
+			t.Errorf("item at '%s' should not have been evicted, got '%v'", key, err)
+		}
+	}
+	// overwriting counts as a use, foo0 is now the least recently used
+	myCache.Put("foo2", 22)
+	myCache.Get("foo3", 33)
+	myCache.Get("foo4", 4)
+	if _, err := myCache.Get("foo0"); !IsValueNotPresentError(err) {
+		t.Errorf("least recently used item should have been evicted, got '%v'", err)
+	}
+	myCache.Remove("foo2")
+	myCache.Put("foo5", 5)
+	for _, key := range []string{"foo3", "foo4", "foo5"} {
+		if _, err := myCache.Get(key); err != nil {
+			t.Errorf("item at '%s' should not have been evicted, got '%v'", key, err)
+		}
+	}
+}
+
+func TestCost(t *testing.T) {
+	myCache := NewCache(nil, nil, WithMaxCost(10))
+	defer myCache.Destroy()
+	myCache.Put("foo", "12345")
+	myCache.Put("bar", []byte("123"))
+	myCache.Get("foo")
+	// bar is the least recently used, 5 + 3 + 4 is over budget
+	myCache.Get("baz", "1234")
+	if _, err := myCache.Get("bar"); !IsValueNotPresentError(err) {
+		t.Errorf("least recently used item should have been evicted, got '%v'", err)
+	}
+	if _, err := myCache.Get("foo"); err != nil {
+		t.Errorf("item at 'foo' should not have been evicted, got '%v'", err)
+	}
+	_, err := myCache.Put("qux", "12345678901")
+	if !IsCostExceededError(err) {
+		t.Errorf("Cacher.Put() should have returned a CostExceededError, got '%v'", err)
+	}
+	if _, err := myCache.Get("qux"); !IsValueNotPresentError(err) {
+		t.Errorf("an item over budget should not have been stored, got '%v'", err)
+	}
+	if _, err := myCache.Get("foo"); err != nil {
+		t.Errorf("a rejected item should not evict anything, got '%v'", err)
+	}
+	// growing foo pushes baz out
+	myCache.Put("foo", "123456789")
+	if _, err := myCache.Get("baz"); !IsValueNotPresentError(err) {
+		t.Errorf("overwriting with a larger value should have evicted, got '%v'", err)
+	}
+	costly := func(key string, value interface{}) int64 {
+		return 4
+	}
+	myCache = NewCache(nil, nil, WithMaxCost(10), WithCostFunc(costly))
+	defer myCache.Destroy()
+	for i := 0; i < 3; i++ {
+		myCache.Put(fmt.Sprintf("foo%d", i), i)
+	}
+	if _, err := myCache.Get("foo0"); !IsValueNotPresentError(err) {
+		t.Errorf("WithCostFunc() cost was not used, got '%v'", err)
+	}
+}
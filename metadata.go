@@ -2,6 +2,7 @@ package cache
 
 import (
 	"fmt"
+	"sync/atomic"
 	"time"
 )
 
@@ -10,7 +11,7 @@ import (
 // are intended to modify the Extra field in Metadata.
 type Metadata struct {
 	// KeyCount is a thread safe pointer to the total count of the cache
-	// KeyCount is managed in a background go routine.
+	// KeyCount is updated atomically.
 	KeyCount *int64
 	// Accessed is a Unix time stamp of the last time an item was retrieved with Cacher.Get
 	Accessed int64
@@ -18,6 +19,21 @@ type Metadata struct {
 	Created int64
 	// Modified is a Unix time stamp of the last time an item was modfied with Cacher.Put
 	Modified int64
+	// Expires is a Unix time stamp in nanoseconds after which the item is removed
+	// regardless of the Invalidator, 0 when the item has no lifetime of its own.
+	// Set with Cacher.PutWithTTL, Cacher.GetWithTTL and Cacher.PutWithStale.
+	Expires int64
+	// Stale is a Unix time stamp in nanoseconds after which the item is stale,
+	// it is still returned until Expires while being revalidated in the
+	// background. 0 when the item is never stale. Set with Cacher.PutWithStale.
+	Stale int64
+	// TTL is the lifetime the item was last written with, Expires is TTL
+	// plus StaleWindow after the write. 0 when the item has no lifetime of
+	// its own.
+	TTL time.Duration
+	// StaleWindow is how long the item is served stale after TTL, 0 when it
+	// is never stale.
+	StaleWindow time.Duration
 	// Extra provides a means for an outside implementation of Invalidator to determine
 	// if an item is valid.
 	Extra interface{}
@@ -30,14 +46,73 @@ func (m Metadata) String() string {
   "Accessed": %d,
   "Created": %d,
   "Modified": %d,
+  "Expires": %d,
+  "Stale": %d,
+  "TTL": %d,
+  "StaleWindow": %d,
   "Extra": "%#v"
 }`,
-		m.KeyCount, m.Accessed, m.Created, m.Modified, m.Extra)
+		m.KeyCount, m.Accessed, m.Created, m.Modified, m.Expires, m.Stale,
+		m.TTL, m.StaleWindow, m.Extra)
+}
+
+// lifetime is how long an item lives, a ttl <= 0 means no lifetime. With a
+// stale window the item is stale after ttl and removed stale later.
+type lifetime struct {
+	ttl   time.Duration
+	stale time.Duration
+}
+
+// setLifetime sets Stale and Expires to life from now.
+func (m *Metadata) setLifetime(life lifetime) {
+	m.Stale, m.Expires, m.TTL, m.StaleWindow = 0, 0, 0, 0
+	if life.ttl <= 0 {
+		return
+	}
+	m.TTL = life.ttl
+	now := time.Now()
+	if life.stale > 0 {
+		m.StaleWindow = life.stale
+		m.Stale = now.Add(life.ttl).UnixNano()
+		m.Expires = now.Add(life.ttl + life.stale).UnixNano()
+		return
+	}
+	m.Expires = now.Add(life.ttl).UnixNano()
+}
+
+// storedLifetime is the lifetime the item was last written with.
+func (m *Metadata) storedLifetime() lifetime {
+	return lifetime{ttl: m.TTL, stale: m.StaleWindow}
+}
+
+// remainingLifetime is what is left of the item's lifetime at now, false
+// once it has expired. An item in its stale window keeps only its time to
+// expire.
+func (m *Metadata) remainingLifetime(now time.Time) (lifetime, bool) {
+	if m.Expires <= 0 {
+		return lifetime{}, true
+	}
+	at := now.UnixNano()
+	if at >= m.Expires {
+		return lifetime{}, false
+	}
+	if m.Stale > 0 && at < m.Stale {
+		return lifetime{ttl: time.Duration(m.Stale - at), stale: time.Duration(m.Expires - m.Stale)}, true
+	}
+	return lifetime{ttl: time.Duration(m.Expires - at)}, true
+}
+
+// expired reports whether the item's own lifetime has passed at now.
+func (m *Metadata) expired(now time.Time) bool {
+	return m.Expires > 0 && now.UnixNano() >= m.Expires
+}
+
+// stale reports whether the item is past its fresh deadline at now.
+func (m *Metadata) stale(now time.Time) bool {
+	return m.Stale > 0 && now.UnixNano() >= m.Stale
 }
 
 type metadataHelper struct {
-	keyCounter     chan int8
-	quit           chan int8
 	count          int64
 	accessCallback func(*Metadata)
 	createCallback func(*Metadata)
@@ -46,19 +121,16 @@ type metadataHelper struct {
 
 func newMetadataHelper(accessCB, createCB, updateCB func(*Metadata)) *metadataHelper {
 	toRet := &metadataHelper{
-		keyCounter:     make(chan int8),
-		quit:           make(chan int8),
 		count:          0,
 		accessCallback: accessCB,
 		createCallback: createCB,
 		updateCallback: updateCB,
 	}
-	go toRet.begin()
 	return toRet
 }
 
 func (m *metadataHelper) Create(data *Metadata) {
-	m.keyCounter <- 1
+	atomic.AddInt64(&m.count, 1)
 	data.Accessed = -1
 	data.Created = time.Now().Unix()
 	data.Modified = -1
@@ -68,8 +140,17 @@ func (m *metadataHelper) Create(data *Metadata) {
 	}
 }
 
+// Adopt counts an item that was already in the cache, leaving its
+// time stamps alone.
+func (m *metadataHelper) Adopt(data *Metadata) {
+	atomic.AddInt64(&m.count, 1)
+	data.KeyCount = m.getCount()
+}
+
 func (m *metadataHelper) Access(data *Metadata) {
 	data.Accessed = time.Now().Unix()
+	// items decoded from bytes arrive without KeyCount
+	data.KeyCount = m.getCount()
 	if m.accessCallback != nil {
 		m.accessCallback(data)
 	}
@@ -77,33 +158,25 @@ func (m *metadataHelper) Access(data *Metadata) {
 
 func (m *metadataHelper) Update(data *Metadata) {
 	data.Modified = time.Now().Unix()
+	data.KeyCount = m.getCount()
 	if m.updateCallback != nil {
 		m.updateCallback(data)
 	}
 }
 
 func (m *metadataHelper) Remove() {
-	m.keyCounter <- -1
+	atomic.AddInt64(&m.count, -1)
 }
 
 func (m *metadataHelper) Clear() {
-	close(m.quit)
-	m.count = 0
-	m.quit = make(chan int8)
-	go m.begin()
+	atomic.StoreInt64(&m.count, 0)
 }
 
 func (m *metadataHelper) getCount() *int64 {
 	return &m.count
 }
 
-func (m *metadataHelper) begin() {
-	for {
-		select {
-		case tmp := <-m.keyCounter:
-			m.count += int64(tmp)
-		case <-m.quit:
-			return
-		}
-	}
+// Len is the current value of KeyCount, safe to call from any go routine.
+func (m *metadataHelper) Len() int64 {
+	return atomic.LoadInt64(&m.count)
 }
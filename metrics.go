@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// statser is anything that reports Stats, every Cache does.
+type statser interface {
+	Stats() Stats
+}
+
+// registry holds the caches created with WithName.
+var registry = struct {
+	sync.RWMutex
+	caches map[string]statser
+}{
+	caches: make(map[string]statser),
+}
+
+func register(name string, s statser) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.caches[name] = s
+}
+
+// unregister removes name only if it still belongs to s, a newer cache
+// may have taken the name since.
+func unregister(name string, s statser) {
+	registry.Lock()
+	defer registry.Unlock()
+	if registry.caches[name] == s {
+		delete(registry.caches, name)
+	}
+}
+
+type metric struct {
+	name  string
+	kind  string
+	help  string
+	value func(Stats) int64
+}
+
+var metrics = []metric{
+	{"cache_hits_total", "counter", "Get calls that found an item.",
+		func(s Stats) int64 { return s.Hits }},
+	{"cache_misses_total", "counter", "Get calls that found nothing.",
+		func(s Stats) int64 { return s.Misses }},
+	{"cache_get_inserts_total", "counter", "Defaults inserted by Get.",
+		func(s Stats) int64 { return s.GetInserts }},
+	{"cache_puts_total", "counter", "Items stored with Put or by a Loader.",
+		func(s Stats) int64 { return s.Puts }},
+	{"cache_overwrites_total", "counter", "Puts that replaced an existing item.",
+		func(s Stats) int64 { return s.Overwrites }},
+	{"cache_removes_total", "counter", "Items removed with Remove.",
+		func(s Stats) int64 { return s.Removes }},
+	{"cache_expirations_total", "counter", "Items removed by the reaper.",
+		func(s Stats) int64 { return s.Expirations }},
+	{"cache_evictions_total", "counter", "Items evicted to stay within capacity.",
+		func(s Stats) int64 { return s.Evictions }},
+	{"cache_loader_calls_total", "counter", "Times a Loader ran.",
+		func(s Stats) int64 { return s.LoaderCalls }},
+	{"cache_loader_errors_total", "counter", "Times a Loader returned an error.",
+		func(s Stats) int64 { return s.LoaderErrors }},
+	{"cache_refreshes_total", "counter", "Background reloads started ahead of expiry.",
+		func(s Stats) int64 { return s.Refreshes }},
+	{"cache_refresh_errors_total", "counter", "Background reloads that failed.",
+		func(s Stats) int64 { return s.RefreshErrors }},
+	{"cache_negative_hits_total", "counter", "Lookups of keys cached as not found.",
+		func(s Stats) int64 { return s.NegativeHits }},
+	{"cache_negative_inserts_total", "counter", "Loader misses cached as not found.",
+		func(s Stats) int64 { return s.NegativeInserts }},
+	{"cache_entries", "gauge", "Items currently in the cache.",
+		func(s Stats) int64 { return s.Entries }},
+	{"cache_negative_entries", "gauge", "Keys currently cached as not found.",
+		func(s Stats) int64 { return s.NegativeEntries }},
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// WriteMetrics writes the Stats of every cache created with WithName in the
+// Prometheus text exposition format, labeled with the cache name.
+// Counters restart from 0 after Cache.ResetStats.
+func WriteMetrics(w io.Writer) error {
+	registry.RLock()
+	names := make([]string, 0, len(registry.caches))
+	stats := make(map[string]Stats, len(registry.caches))
+	for name, s := range registry.caches {
+		names = append(names, name)
+		stats[name] = s.Stats()
+	}
+	registry.RUnlock()
+	sort.Strings(names)
+
+	buf := bufio.NewWriter(w)
+	for _, m := range metrics {
+		fmt.Fprintf(buf, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(buf, "# TYPE %s %s\n", m.name, m.kind)
+		for _, name := range names {
+			fmt.Fprintf(
+				buf, "%s{cache=\"%s\"} %d\n",
+				m.name, labelEscaper.Replace(name), m.value(stats[name]),
+			)
+		}
+	}
+	return buf.Flush()
+}
+
+// MetricsHandler returns an http.Handler serving WriteMetrics, suitable for
+// a Prometheus scrape target.
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := WriteMetrics(w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
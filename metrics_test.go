@@ -0,0 +1,47 @@
+package cache
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	sessions := NewCache(nil, nil, WithName("sessions"))
+	tokens := NewTypedCache[int, string](nil, nil, WithName(`to"kens`))
+	anon := NewCache(nil, nil)
+	defer anon.Destroy()
+	sessions.Put("foo", "foo")
+	sessions.Get("foo")
+	sessions.Get("bar")
+	tokens.Get(1)
+	anon.Get("foo")
+
+	rec := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	for _, line := range []string{
+		"# TYPE cache_hits_total counter",
+		`cache_hits_total{cache="sessions"} 1`,
+		`cache_misses_total{cache="sessions"} 1`,
+		`cache_misses_total{cache="to\"kens"} 1`,
+		`cache_puts_total{cache="sessions"} 1`,
+		"# TYPE cache_entries gauge",
+	} {
+		if !strings.Contains(string(body), line+"\n") {
+			t.Errorf("MetricsHandler() output is missing '%s', got\n%s", line, body)
+		}
+	}
+	if strings.Count(string(body), "cache_misses_total{") != 2 {
+		t.Errorf("MetricsHandler() should only export named caches, got\n%s", body)
+	}
+
+	sessions.Destroy()
+	tokens.Destroy()
+	var out strings.Builder
+	WriteMetrics(&out)
+	if strings.Contains(out.String(), "{cache=") {
+		t.Errorf("destroyed caches should not be exported, got\n%s", out.String())
+	}
+}
@@ -0,0 +1,51 @@
+package cache
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// NegativeCacheHitError is returned for a key that a Loader recently
+// reported as not found, see WithNegativeCaching.
+type NegativeCacheHitError struct {
+	Key string // The item key.
+}
+
+// Error satisfies the Error interface.
+func (n NegativeCacheHitError) Error() string {
+	return fmt.Sprintf("key '%s' is cached as not found", n.Key)
+}
+
+// IsNegativeCacheHitError is a simple test to determine if an error
+// is of type 'NegativeCacheHitError'.
+func IsNegativeCacheHitError(err error) bool {
+	_, ok := err.(NegativeCacheHitError)
+	return ok
+}
+
+// notFound reports whether a Loader's err means there is nothing at the key.
+func notFound(err error) bool {
+	return IsValueNotPresentError(err) || IsNegativeCacheHitError(err)
+}
+
+// negativeHit returns a NegativeCacheHitError if key is cached as not found,
+// counting the hit.
+func (c *cache[K, V]) negativeHit(key K) error {
+	if c.negativeTTL <= 0 {
+		return nil
+	}
+	deadline, ok := c.negatives.deadline(key)
+	if !ok || time.Now().UnixNano() >= deadline {
+		return nil
+	}
+	atomic.AddInt64(&c.stats.negativeHits, 1)
+	return NegativeCacheHitError{Key: keyString(key)}
+}
+
+// rememberNotFound caches key as not found for the WithNegativeCaching ttl.
+func (c *cache[K, V]) rememberNotFound(key K) error {
+	c.negatives.schedule(key, time.Now().Add(c.negativeTTL).UnixNano())
+	atomic.AddInt64(&c.stats.negativeInserts, 1)
+	return NegativeCacheHitError{Key: keyString(key)}
+}
@@ -0,0 +1,147 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNegativeCaching(t *testing.T) {
+	t.Run("mechanic=Hit", testNegativeHit)
+	t.Run("mechanic=Expiry", testNegativeExpiry)
+	t.Run("mechanic=Put", testNegativePut)
+	t.Run("mechanic=Disabled", testNegativeDisabled)
+	t.Run("mechanic=Tiered", testNegativeTiered)
+}
+
+// missingLoader returns a loader reporting nothing at key, counting its runs.
+func missingLoader(calls *int32) Loader[interface{}] {
+	return func(context.Context) (interface{}, error) {
+		atomic.AddInt32(calls, 1)
+		return nil, ValueNotPresentError{}
+	}
+}
+
+func testNegativeHit(t *testing.T) {
+	myCache := NewCache(nil, nil, WithNegativeCaching(time.Hour))
+	defer myCache.Destroy()
+	var calls int32
+	for i := 0; i < 3; i++ {
+		_, err := myCache.GetOrLoad(context.Background(), "foo", missingLoader(&calls))
+		if !IsNegativeCacheHitError(err) {
+			t.Errorf("Cacher.GetOrLoad() expected a NegativeCacheHitError, got '%v'", err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("a loader miss should be cached, loader ran %d times", calls)
+	}
+	if _, err := myCache.Get("foo"); !IsNegativeCacheHitError(err) || IsValueNotPresentError(err) {
+		t.Errorf("Cacher.Get() expected a NegativeCacheHitError, got '%v'", err)
+	}
+	if _, _, err := myCache.GetStale("foo"); !IsNegativeCacheHitError(err) {
+		t.Errorf("Cacher.GetStale() expected a NegativeCacheHitError, got '%v'", err)
+	}
+	if _, err := myCache.Get("bar"); !IsValueNotPresentError(err) {
+		t.Errorf("Cacher.Get() expected a ValueNotPresentError, got '%v'", err)
+	}
+	stats := myCache.Stats()
+	if stats.NegativeHits != 4 || stats.NegativeInserts != 1 || stats.NegativeEntries != 1 ||
+		stats.Misses != 2 || stats.LoaderErrors != 0 || stats.Entries != 0 {
+		t.Errorf("negative entries were not counted apart, got\n%+v", stats)
+	}
+}
+
+func testNegativeExpiry(t *testing.T) {
+	ttl, _ := time.ParseDuration("50ms")
+	myCache := NewCache(nil, nil, WithNegativeCaching(ttl), WithReaperInterval(ttl/5))
+	defer myCache.Destroy()
+	var calls int32
+	myCache.GetOrLoad(context.Background(), "foo", missingLoader(&calls))
+	if !waitFor(func() bool { return myCache.Stats().NegativeEntries == 0 }) {
+		t.Errorf("the reaper should drop negative entries after their ttl")
+	}
+	if _, err := myCache.Get("foo"); !IsValueNotPresentError(err) {
+		t.Errorf("Cacher.Get() expected a ValueNotPresentError after the ttl, got '%v'", err)
+	}
+	myCache.GetOrLoad(context.Background(), "foo", missingLoader(&calls))
+	if calls != 2 {
+		t.Errorf("the loader should run again after the ttl, ran %d times", calls)
+	}
+}
+
+func testNegativePut(t *testing.T) {
+	myCache := NewCache(nil, nil, WithNegativeCaching(time.Hour))
+	defer myCache.Destroy()
+	var calls int32
+	for _, key := range []string{"foo", "bar", "baz"} {
+		myCache.GetOrLoad(context.Background(), key, missingLoader(&calls))
+	}
+	myCache.Put("foo", "foo")
+	myCache.PutMany(map[string]interface{}{"bar": "bar"})
+	if found, err := myCache.Get("baz", "baz"); err != nil || found != "baz" {
+		t.Errorf("Cacher.Get() should insert a default over a negative entry, got '%#v', '%v'", found, err)
+	}
+	myCache.Remove("foo")
+	if _, err := myCache.Get("foo"); !IsValueNotPresentError(err) {
+		t.Errorf("storing a key should drop its negative entry, got '%v'", err)
+	}
+	if found, err := myCache.Get("bar"); err != nil || found != "bar" {
+		t.Errorf("Cacher.Get() expected '%s', got '%#v', '%v'", "bar", found, err)
+	}
+	if n := myCache.Stats().NegativeEntries; n != 0 {
+		t.Errorf("expected no negative entries, got %d", n)
+	}
+	myCache.GetOrLoad(context.Background(), "qux", missingLoader(&calls))
+	myCache.Clear()
+	if _, err := myCache.Get("qux"); !IsValueNotPresentError(err) {
+		t.Errorf("Cacher.Clear() should drop negative entries, got '%v'", err)
+	}
+}
+
+func testNegativeDisabled(t *testing.T) {
+	myCache := NewCache(nil, nil, WithLoaderErrorCaching(time.Hour))
+	defer myCache.Destroy()
+	var calls int32
+	_, err := myCache.GetOrLoad(context.Background(), "foo", missingLoader(&calls))
+	if !IsValueNotPresentError(err) {
+		t.Errorf("Cacher.GetOrLoad() expected the loader's error, got '%v'", err)
+	}
+	if _, err := myCache.Get("foo"); !IsValueNotPresentError(err) {
+		t.Errorf("Cacher.Get() expected a ValueNotPresentError, got '%v'", err)
+	}
+	if stats := myCache.Stats(); stats.NegativeInserts != 0 || stats.LoaderErrors != 1 {
+		t.Errorf("a loader miss should be a loader error, got\n%+v", stats)
+	}
+}
+
+func testNegativeTiered(t *testing.T) {
+	l1 := NewCache(nil, nil, WithNegativeCaching(time.Hour))
+	l2 := NewCache(nil, nil, WithNegativeCaching(time.Hour))
+	myCache := NewTieredCache(l1, l2)
+	defer myCache.Destroy()
+	var calls int32
+	loadErr := errors.New("load failed")
+	for i := 0; i < 2; i++ {
+		_, err := myCache.GetOrLoad(context.Background(), "foo", missingLoader(&calls))
+		if !IsNegativeCacheHitError(err) {
+			t.Errorf("Cacher.GetOrLoad() expected a NegativeCacheHitError, got '%v'", err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("a loader miss should be cached, loader ran %d times", calls)
+	}
+	if _, err := myCache.Get("foo"); !IsNegativeCacheHitError(err) {
+		t.Errorf("Cacher.Get() expected a NegativeCacheHitError, got '%v'", err)
+	}
+	_, err := myCache.GetOrLoad(context.Background(), "bar", func(context.Context) (interface{}, error) {
+		return nil, loadErr
+	})
+	if err != loadErr {
+		t.Errorf("Cacher.GetOrLoad() expected '%s', got '%v'", loadErr, err)
+	}
+	if stats := myCache.Stats(); stats.NegativeInserts != 2 || stats.NegativeEntries != 1 {
+		t.Errorf("negative entries of both tiers were not counted, got\n%+v", stats)
+	}
+}
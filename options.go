@@ -0,0 +1,142 @@
+package cache
+
+import (
+	"time"
+)
+
+// Option configures optional behavior of a Cache, passed to NewCache
+// or NewTypedCache.
+type Option func(*options)
+
+type options struct {
+	loaderErrorTTL time.Duration
+	maxEntries     int
+	maxCost        int64
+	cost           CostFunc
+	name           string
+	reapInterval   time.Duration
+	reapJitter     time.Duration
+	scanLimit      int
+	refreshAhead   float64
+	negativeTTL    time.Duration
+}
+
+func newOptions(opts []Option) *options {
+	toRet := &options{
+		cost:         DefaultCost,
+		reapInterval: 100 * time.Millisecond,
+	}
+	for _, opt := range opts {
+		opt(toRet)
+	}
+	return toRet
+}
+
+// WithLoaderErrorCaching makes GetOrLoad remember an error returned by a
+// loader for lifetime. Calls for the same key during that time return the
+// error without running a loader. By default loader errors are not cached.
+func WithLoaderErrorCaching(lifetime time.Duration) Option {
+	return func(o *options) {
+		o.loaderErrorTTL = lifetime
+	}
+}
+
+// WithNegativeCaching makes GetOrLoad remember for ttl that a loader found
+// nothing at a key, which it reports by returning a ValueNotPresentError.
+// Until then, or until the key is stored, GetOrLoad, Get, GetContext and
+// GetStale return a NegativeCacheHitError for the key without running a
+// loader, and GetOrLoad returns one for the loader's miss too. Negative
+// entries count in Stats.NegativeHits, NegativeInserts and NegativeEntries
+// rather than in Hits, Misses, LoaderErrors or Entries. By default loader
+// misses are not cached.
+func WithNegativeCaching(ttl time.Duration) Option {
+	return func(o *options) {
+		o.negativeTTL = ttl
+	}
+}
+
+// WithMaxEntries caps the cache at max items. Inserting past the cap
+// immediately evicts the least recently used items, where use is any
+// Get, GetOrLoad or Put of an item. A max <= 0 means no cap, the default.
+func WithMaxEntries(max int) Option {
+	return func(o *options) {
+		o.maxEntries = max
+	}
+}
+
+// WithMaxCost caps the total cost of the items in the cache at max, as
+// measured by the CostFunc set with WithCostFunc or DefaultCost. Inserting
+// past the cap immediately evicts the least recently used items until the
+// new item fits, an item costing more than max is rejected with a
+// CostExceededError. A max <= 0 means no cap, the default.
+func WithMaxCost(max int64) Option {
+	return func(o *options) {
+		o.maxCost = max
+	}
+}
+
+// WithCostFunc sets the CostFunc used by WithMaxCost.
+func WithCostFunc(cost CostFunc) Option {
+	return func(o *options) {
+		if cost != nil {
+			o.cost = cost
+		}
+	}
+}
+
+// WithName names the cache so its Stats are exported by WriteMetrics and
+// MetricsHandler until it is destroyed. A later cache with the same name
+// replaces it in the export.
+func WithName(name string) Option {
+	return func(o *options) {
+		o.name = name
+	}
+}
+
+// WithReaperInterval sets how often the reaper looks for expired and invalid
+// items, 100ms by default. Non positive intervals are ignored.
+func WithReaperInterval(interval time.Duration) Option {
+	return func(o *options) {
+		if interval > 0 {
+			o.reapInterval = interval
+		}
+	}
+}
+
+// WithReaperJitter adds a random delay of up to jitter to every reaper
+// interval, so many caches created together don't all reap at once.
+func WithReaperJitter(jitter time.Duration) Option {
+	return func(o *options) {
+		o.reapJitter = jitter
+	}
+}
+
+// WithReaperScanLimit caps how many items a reaper pass polls with
+// Invalidator.IsValid, later passes continue where the last one stopped.
+// Only Invalidators that are neither a NopInvalidator nor an
+// ExpiringInvalidator are polled. A limit <= 0 means no cap, the default.
+func WithReaperScanLimit(limit int) Option {
+	return func(o *options) {
+		o.scanLimit = limit
+	}
+}
+
+// WithRefreshAhead reloads an item in the background with the KeyLoader set
+// by Cache.SetLoader when it is looked up with less than fraction of its
+// lifetime left, callers keep getting the current value meanwhile. Only
+// items with a ttl or an ExpiringInvalidator deadline have a lifetime. A
+// failed reload leaves the current value in place and counts in
+// Stats.RefreshErrors, the item isn't reloaded again for its ttl, the
+// WithLoaderErrorCaching lifetime if set, or a second if it has no ttl.
+// fraction is clamped to [0, 1], 0 is off, the default.
+func WithRefreshAhead(fraction float64) Option {
+	return func(o *options) {
+		if fraction > 1 {
+			fraction = 1
+		}
+		if fraction < 0 {
+			fraction = 0
+		}
+		o.refreshAhead = fraction
+	}
+}
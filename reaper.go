@@ -0,0 +1,184 @@
+package cache
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+type reaper struct {
+	*metadataHelper
+	Invalidator
+}
+
+func newReaper(inv Invalidator) *reaper {
+	return &reaper{
+		newMetadataHelper(inv.AccessExtra, inv.CreateExtra, inv.UpdateExtra),
+		inv,
+	}
+}
+
+// scanCursor is where an incremental full scan left off, keys is a snapshot
+// of the cache taken when the scan started.
+type scanCursor[K comparable] struct {
+	keys []K
+	pos  int
+}
+
+func (c *cache[K, V]) PauseReaper() {
+	atomic.StoreInt32(&c.paused, 1)
+}
+
+func (c *cache[K, V]) ResumeReaper() {
+	atomic.StoreInt32(&c.paused, 0)
+}
+
+func (c *cache[K, V]) isPaused() bool {
+	return atomic.LoadInt32(&c.paused) == 1
+}
+
+func (c *cache[K, V]) begin() {
+	timer := time.NewTimer(c.nextReap())
+	for {
+		select {
+		case <-c.quit:
+			timer.Stop()
+			return
+		case <-timer.C:
+			if !c.isPaused() {
+				c.reap(time.Now())
+			}
+			timer.Reset(c.nextReap())
+		}
+	}
+}
+
+// nextReap is how long to wait for the next reaper pass.
+func (c *cache[K, V]) nextReap() time.Duration {
+	if c.reapJitter <= 0 {
+		return c.reapInterval
+	}
+	return c.reapInterval + time.Duration(rand.Int63n(int64(c.reapJitter)+1))
+}
+
+// deadline is when the item expires by its own ttl or by the Invalidator,
+// as a Unix time stamp in nanoseconds, 0 if it never does.
+func (c *cache[K, V]) deadline(data *Metadata) int64 {
+	toRet := data.Expires
+	if c.expiring == nil {
+		return toRet
+	}
+	if at, ok := c.expiring.ExpiresAt(data); ok {
+		if toRet <= 0 || at.UnixNano() < toRet {
+			toRet = at.UnixNano()
+		}
+	}
+	return toRet
+}
+
+// expiry reports whether the item has expired at now without polling
+// Invalidator.IsValid, and the reason why. Nothing expires while the reaper
+// is paused.
+func (c *cache[K, V]) expiry(data *Metadata, now time.Time) (RemovalReason, bool) {
+	if c.isPaused() {
+		return 0, false
+	}
+	if data.expired(now) {
+		return Expired, true
+	}
+	if c.expiring == nil {
+		return 0, false
+	}
+	if at, ok := c.expiring.ExpiresAt(data); ok && !now.Before(at) {
+		return Invalidated, true
+	}
+	return 0, false
+}
+
+// reap removes every item that is due to expire at now, then scans the
+// cache if the Invalidator can only tell whether an item is valid by asking.
+func (c *cache[K, V]) reap(now time.Time) {
+	for _, key := range c.expiries.due(now.UnixNano()) {
+		c.reapKey(key, now)
+	}
+	c.negatives.due(now.UnixNano())
+	if c.fullScan {
+		c.scan(now)
+	}
+}
+
+// reapKey removes key if it is due to expire at now.
+func (c *cache[K, V]) reapKey(key K, now time.Time) {
+	unlock := c.keys.lock(key)
+	elem, err := c.dataHandler.Get(key)
+	if err != nil {
+		unlock()
+		return
+	}
+	reason, expired := c.expiry(&elem.metadata, now)
+	if !expired {
+		// the deadline moved since it was scheduled
+		c.expiries.schedule(key, c.deadline(&elem.metadata))
+		unlock()
+		return
+	}
+	err = c.dataHandler.Remove(key)
+	if err == nil {
+		c.forget(key, reason)
+	}
+	unlock()
+	if err == nil {
+		c.removals.notify(key, elem.data, reason)
+	}
+}
+
+// scan polls every item with Invalidator.IsValid. With a scan limit it
+// checks at most that many items per call, picking up where the last call
+// stopped.
+func (c *cache[K, V]) scan(now time.Time) {
+	cb := func(key K, elem Element[V]) bool {
+		select {
+		case <-c.quit:
+			return false
+		default:
+		}
+		reason, expired := c.expiry(&elem.metadata, now)
+		if !expired {
+			elem.metadata.KeyCount = c.reaper.getCount()
+			if c.reaper.IsValid(&elem.metadata) {
+				return true
+			}
+			reason = Invalidated
+		}
+		if c.dataHandler.Remove(key) == nil {
+			c.removed(key, elem.data, reason)
+		}
+		return true
+	}
+	if c.scanLimit <= 0 {
+		c.dataHandler.Range(cb)
+		return
+	}
+	if c.cursor.pos >= len(c.cursor.keys) {
+		c.cursor.keys = c.cursor.keys[:0]
+		c.cursor.pos = 0
+		c.dataHandler.Range(func(key K, _ Element[V]) bool {
+			c.cursor.keys = append(c.cursor.keys, key)
+			return true
+		})
+	}
+	end := c.cursor.pos + c.scanLimit
+	if end > len(c.cursor.keys) {
+		end = len(c.cursor.keys)
+	}
+	for _, key := range c.cursor.keys[c.cursor.pos:end] {
+		elem, err := c.dataHandler.Get(key)
+		if err != nil {
+			continue
+		}
+		if !cb(key, elem) {
+			break
+		}
+	}
+	c.cursor.pos = end
+}
@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"fmt"
 	"testing"
 	"time"
 )
@@ -8,6 +9,90 @@ import (
 func TestReaper(t *testing.T) {
 	t.Run("MetadataHelper", testHelperFuncs)
 	t.Run("Counter", testCounting)
+	t.Run("Interval", testReaperInterval)
+	t.Run("Pause", testReaperPause)
+	t.Run("ScanLimit", testReaperScanLimit)
+}
+
+func testReaperInterval(t *testing.T) {
+	myCache := NewCache(nil, nil, WithReaperInterval(time.Hour))
+	defer myCache.Destroy()
+	removed := make(chan int8, 1)
+	myCache.OnEvict(func(string, interface{}, RemovalReason) {
+		removed <- 1
+	})
+	myCache.PutWithTTL("foo", "foo", time.Millisecond)
+	select {
+	case <-removed:
+		t.Errorf("the reaper should not have run yet")
+	case <-time.After(300 * time.Millisecond):
+	}
+	myCache = NewCache(
+		nil, nil,
+		WithReaperInterval(10*time.Millisecond), WithReaperJitter(10*time.Millisecond),
+	)
+	defer myCache.Destroy()
+	myCache.OnEvict(func(string, interface{}, RemovalReason) {
+		removed <- 1
+	})
+	myCache.PutWithTTL("foo", "foo", time.Millisecond)
+	select {
+	case <-removed:
+	case <-time.After(100 * time.Millisecond):
+		t.Errorf("the reaper should have run by now")
+	}
+}
+
+func testReaperPause(t *testing.T) {
+	myCache := NewCache(nil, nil)
+	defer myCache.Destroy()
+	myCache.PauseReaper()
+	myCache.PutWithTTL("foo", "foo", time.Millisecond)
+	time.Sleep(300 * time.Millisecond)
+	if found, err := myCache.Get("foo"); err != nil || found != "foo" {
+		t.Errorf("nothing should expire while paused, got '%#v', '%v'", found, err)
+	}
+	myCache.ResumeReaper()
+	time.Sleep(300 * time.Millisecond)
+	if _, err := myCache.Get("foo"); !IsValueNotPresentError(err) {
+		t.Errorf("item should have expired after resuming, got '%v'", err)
+	}
+}
+
+// countingInvalidator counts IsValid calls and finds nothing valid.
+type countingInvalidator struct {
+	NopInvalidator
+	calls int
+}
+
+func (c *countingInvalidator) IsValid(*Metadata) bool {
+	c.calls++
+	return false
+}
+
+func testReaperScanLimit(t *testing.T) {
+	inv := new(countingInvalidator)
+	myCache := newCache[string, interface{}](
+		dataHandlerAdapter{NewInMemoryDataHandler()}, inv,
+		[]Option{WithReaperInterval(time.Hour), WithReaperScanLimit(3)},
+	)
+	defer myCache.Destroy()
+	for i := 0; i < 5; i++ {
+		myCache.Put(fmt.Sprintf("foo%d", i), i)
+	}
+	myCache.reap(time.Now())
+	if inv.calls != 3 || myCache.Stats().Expirations != 3 {
+		t.Errorf("first pass should poll 3 items, polled %d", inv.calls)
+	}
+	myCache.Put("bar", "bar")
+	myCache.reap(time.Now())
+	if inv.calls != 5 || myCache.Stats().Expirations != 5 {
+		t.Errorf("second pass should finish the scan, polled %d", inv.calls)
+	}
+	myCache.reap(time.Now())
+	if inv.calls != 6 {
+		t.Errorf("third pass should start a new scan, polled %d", inv.calls)
+	}
 }
 
 func testHelperFuncs(t *testing.T) {
@@ -0,0 +1,164 @@
+package cache
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// KeyLoader computes the value for key, used to reload items in the
+// background, see Cache.SetLoader.
+type KeyLoader[K comparable, V any] func(context.Context, K) (V, error)
+
+// loaderHolder lets a nil KeyLoader be stored in an atomic.Value.
+type loaderHolder[K comparable, V any] struct {
+	loader KeyLoader[K, V]
+}
+
+func (c *cache[K, V]) SetLoader(loader KeyLoader[K, V]) {
+	c.loader.Store(loaderHolder[K, V]{loader})
+}
+
+func (c *cache[K, V]) keyLoader() KeyLoader[K, V] {
+	holder, _ := c.loader.Load().(loaderHolder[K, V])
+	return holder.loader
+}
+
+// accessed starts a background reload of an item being looked up if it is
+// stale or due for a refresh ahead of expiry, returning whether it is stale.
+// Call it before Access, which may move the deadline.
+func (c *cache[K, V]) accessed(key K, data *Metadata, now time.Time) bool {
+	if data.stale(now) {
+		c.reload(key, data)
+		return true
+	}
+	if c.refreshAhead <= 0 {
+		return false
+	}
+	deadline := c.deadline(data)
+	if data.Stale > 0 && data.Stale < deadline {
+		deadline = data.Stale
+	}
+	if deadline <= 0 {
+		return false
+	}
+	lifetime := int64(data.TTL)
+	if data.TTL <= 0 || deadline != data.Stale && deadline != data.Expires {
+		// the deadline isn't the item's own, Created and Modified are
+		// whole seconds
+		written := data.Created
+		if data.Modified > written {
+			written = data.Modified
+		}
+		lifetime = deadline - time.Unix(written, 0).UnixNano()
+	}
+	if lifetime <= 0 || float64(deadline-now.UnixNano()) > c.refreshAhead*float64(lifetime) {
+		return false
+	}
+	c.reload(key, data)
+	return false
+}
+
+// defaultRefreshRetry is how long a failed reload of an item without a ttl
+// of its own waits to be retried.
+const defaultRefreshRetry = time.Second
+
+// reload starts a background reload of key with the KeyLoader unless one is
+// already running or the last one failed and isn't due for a retry.
+func (c *cache[K, V]) reload(key K, data *Metadata) {
+	loader := c.keyLoader()
+	if loader == nil {
+		return
+	}
+	now := time.Now().UnixNano()
+	c.refreshMu.Lock()
+	retry, busy := c.refreshing[key]
+	if busy && (retry == 0 || now < retry) {
+		c.refreshMu.Unlock()
+		return
+	}
+	c.refreshing[key] = 0
+	c.refreshMu.Unlock()
+	// the new value lives as long as the old one did
+	go c.refresh(key, loader, data.storedLifetime())
+}
+
+// refreshRetry is how long after a failed reload of an item with life the
+// next one may start: the WithLoaderErrorCaching lifetime if set, otherwise
+// the item's ttl, so a failing loader is asked about once per fresh period.
+func (c *cache[K, V]) refreshRetry(life lifetime) time.Duration {
+	if c.loads.errorTTL > 0 {
+		return c.loads.errorTTL
+	}
+	if life.ttl > 0 {
+		return life.ttl
+	}
+	return defaultRefreshRetry
+}
+
+// forgetRefresh drops a failed reload of key, a reload in flight is left
+// to finish.
+func (c *cache[K, V]) forgetRefresh(key K) {
+	c.refreshMu.Lock()
+	if c.refreshing[key] != 0 {
+		delete(c.refreshing, key)
+	}
+	c.refreshMu.Unlock()
+}
+
+// forgetRefreshes drops every failed reload.
+func (c *cache[K, V]) forgetRefreshes() {
+	c.refreshMu.Lock()
+	for key, retry := range c.refreshing {
+		if retry != 0 {
+			delete(c.refreshing, key)
+		}
+	}
+	c.refreshMu.Unlock()
+}
+
+// refresh reloads key, keeping the current value if loader fails. It shares
+// a run with any GetOrLoad of key in flight.
+func (c *cache[K, V]) refresh(key K, loader KeyLoader[K, V], life lifetime) {
+	var err error
+	defer func() {
+		c.refreshMu.Lock()
+		// an item removed during the reload has nothing to retry
+		if err != nil && !IsValueNotPresentError(err) {
+			c.refreshing[key] = time.Now().Add(c.refreshRetry(life)).UnixNano()
+		} else {
+			delete(c.refreshing, key)
+		}
+		c.refreshMu.Unlock()
+	}()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-c.quit:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	_, err = c.loads.do(ctx, key, func(ctx context.Context) (val V, err error) {
+		atomic.AddInt64(&c.stats.refreshes, 1)
+		// nothing above the reload's goroutine could recover a panic
+		defer func() {
+			if r := recover(); r != nil {
+				atomic.AddInt64(&c.stats.refreshErrors, 1)
+				err = LoaderPanicError{Key: keyString(key), Value: r}
+			}
+		}()
+		val, err = loader(ctx, key)
+		if err != nil {
+			atomic.AddInt64(&c.stats.refreshErrors, 1)
+			return val, err
+		}
+		// don't bring back an item removed during the reload
+		if _, err := c.dataHandler.GetContext(ctx, key); err != nil {
+			return val, err
+		}
+		_, err = c.put(ctx, key, val, life)
+		return val, err
+	})
+}
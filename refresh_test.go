@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitFor polls cond for up to a second.
+func waitFor(cond func() bool) bool {
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return true
+}
+
+func TestRefreshAhead(t *testing.T) {
+	t.Run("reload", func(t *testing.T) {
+		myCache := NewCache(nil, nil, WithRefreshAhead(1))
+		defer myCache.Destroy()
+		var barCalls int32
+		release := make(chan int8)
+		myCache.SetLoader(func(_ context.Context, key string) (interface{}, error) {
+			if key == "bar" {
+				atomic.AddInt32(&barCalls, 1)
+			}
+			<-release
+			return "new", nil
+		})
+		myCache.PutWithTTL("foo", "old", time.Hour)
+		myCache.Put("bar", "old")
+		for i := 0; i < 10; i++ {
+			if found, err := myCache.Get("foo"); err != nil || found != "old" {
+				t.Errorf("Cacher.Get() expected 'old' during the reload, got '%#v', '%v'", found, err)
+			}
+		}
+		close(release)
+		if !waitFor(func() bool { found, _ := myCache.Get("foo"); return found == "new" }) {
+			t.Errorf("Cacher.Get() never returned the reloaded value")
+		}
+		myCache.Get("bar")
+		if stats := myCache.Stats(); stats.Refreshes < 1 || stats.RefreshErrors != 0 {
+			t.Errorf("Cacher.Stats() expected a refresh, got %+v", stats)
+		}
+		found, _ := myCache.(*cache[string, interface{}]).dataHandler.Get("foo")
+		if remaining := time.Until(time.Unix(0, found.metadata.Expires)); remaining < 59*time.Minute {
+			t.Errorf("the reloaded item should have a fresh ttl, %v left", remaining)
+		}
+		time.Sleep(10 * time.Millisecond)
+		if calls := atomic.LoadInt32(&barCalls); calls != 0 {
+			t.Errorf("an item without a lifetime should not be reloaded, %d loader calls", calls)
+		}
+	})
+
+	t.Run("lifetime", func(t *testing.T) {
+		ttl, _ := time.ParseDuration("300ms")
+		myCache := NewCache(nil, nil, WithRefreshAhead(1))
+		defer myCache.Destroy()
+		myCache.SetLoader(func(context.Context, string) (interface{}, error) {
+			return "new", nil
+		})
+		myCache.PutWithTTL("foo", "old", ttl)
+		for i := 0; i < 5; i++ {
+			refreshes := myCache.Stats().Refreshes
+			myCache.Get("foo")
+			if !waitFor(func() bool { return myCache.Stats().Refreshes > refreshes }) {
+				t.Fatalf("Cacher.Get() did not start a reload")
+			}
+		}
+		found, _ := myCache.(*cache[string, interface{}]).dataHandler.Get("foo")
+		if found.metadata.TTL != ttl {
+			t.Errorf("the reloaded item should keep a ttl of %v, got %v", ttl, found.metadata.TTL)
+		}
+		if remaining := time.Until(time.Unix(0, found.metadata.Expires)); remaining > ttl {
+			t.Errorf("reloads should not stretch the ttl of %v, %v left", ttl, remaining)
+		}
+	})
+
+	t.Run("fraction", func(t *testing.T) {
+		myCache := NewCache(nil, nil, WithRefreshAhead(.01))
+		defer myCache.Destroy()
+		myCache.SetLoader(func(context.Context, string) (interface{}, error) {
+			return "new", nil
+		})
+		myCache.PutWithTTL("foo", "old", time.Hour)
+		myCache.Get("foo")
+		time.Sleep(10 * time.Millisecond)
+		if refreshes := myCache.Stats().Refreshes; refreshes != 0 {
+			t.Errorf("an item with most of its lifetime left was reloaded %d times", refreshes)
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		myCache := NewCache(nil, NewTimedInvalidator(time.Hour), WithRefreshAhead(1))
+		defer myCache.Destroy()
+		myCache.SetLoader(func(context.Context, string) (interface{}, error) {
+			return nil, errors.New("load failed")
+		})
+		myCache.Put("foo", "old")
+		myCache.Get("foo")
+		if !waitFor(func() bool { return myCache.Stats().RefreshErrors == 1 }) {
+			t.Errorf("Cacher.Stats() expected a refresh error, got %+v", myCache.Stats())
+		}
+		if found, err := myCache.Get("foo"); err != nil || found != "old" {
+			t.Errorf("Cacher.Get() expected 'old' after a failed reload, got '%#v', '%v'", found, err)
+		}
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		myCache := NewCache(nil, nil)
+		defer myCache.Destroy()
+		myCache.SetLoader(func(context.Context, string) (interface{}, error) {
+			panic("load failed")
+		})
+		myCache.PutWithStale("foo", "old", time.Millisecond, time.Hour)
+		time.Sleep(5 * time.Millisecond)
+		myCache.GetStale("foo")
+		if !waitFor(func() bool { return myCache.Stats().RefreshErrors == 1 }) {
+			t.Errorf("Cacher.Stats() expected a refresh error, got %+v", myCache.Stats())
+		}
+		if found, _, err := myCache.GetStale("foo"); err != nil || found != "old" {
+			t.Errorf("Cacher.GetStale() expected 'old' after a panicking reload, got '%#v', '%v'", found, err)
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"sync"
+)
+
+// RemovalReason describes why an item left the cache, passed to
+// functions registered with Cache.OnEvict.
+type RemovalReason int
+
+const (
+	// Expired items outlived the ttl given to PutWithTTL or GetWithTTL.
+	Expired RemovalReason = iota
+	// Invalidated items were found invalid by the Invalidator.
+	Invalidated
+	// Evicted items were pushed out to keep the cache within its capacity.
+	Evicted
+	// Removed items were removed with Cacher.Remove.
+	Removed
+	// Replaced items were overwritten with Cacher.Put.
+	Replaced
+	// Cleared items were removed by Cacher.Clear or Cacher.Destroy.
+	Cleared
+)
+
+func (r RemovalReason) String() string {
+	switch r {
+	case Expired:
+		return "expired"
+	case Invalidated:
+		return "invalidated"
+	case Evicted:
+		return "evicted"
+	case Removed:
+		return "removed"
+	case Replaced:
+		return "replaced"
+	case Cleared:
+		return "cleared"
+	default:
+		return "unknown"
+	}
+}
+
+// removalListeners holds the functions registered with Cache.OnEvict.
+type removalListeners[K comparable, V any] struct {
+	mu        sync.RWMutex
+	listeners []func(K, V, RemovalReason)
+}
+
+func (r *removalListeners[K, V]) add(f func(K, V, RemovalReason)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.listeners = append(r.listeners, f)
+}
+
+// active reports whether anything is listening, so callers can skip
+// gathering values nobody will see.
+func (r *removalListeners[K, V]) active() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.listeners) > 0
+}
+
+func (r *removalListeners[K, V]) notify(key K, val V, reason RemovalReason) {
+	r.mu.RLock()
+	listeners := r.listeners
+	r.mu.RUnlock()
+	for _, f := range listeners {
+		f(key, val, reason)
+	}
+}
+
+// notifyAll tells the listeners about every removal in gone.
+func (r *removalListeners[K, V]) notifyAll(gone []removal[K, V]) {
+	for _, item := range gone {
+		r.notify(item.key, item.val, item.reason)
+	}
+}
+
+// removal is an item that left the cache, held until its key is unlocked
+// to tell the listeners.
+type removal[K comparable, V any] struct {
+	key    K
+	val    V
+	reason RemovalReason
+}
@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+type removalEvent struct {
+	key    string
+	val    interface{}
+	reason RemovalReason
+}
+
+type removalRecorder struct {
+	mu     sync.Mutex
+	events []removalEvent
+}
+
+func (r *removalRecorder) record(key string, val interface{}, reason RemovalReason) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, removalEvent{key, val, reason})
+}
+
+// take returns and forgets every recorded event.
+func (r *removalRecorder) take() []removalEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	toRet := r.events
+	r.events = nil
+	return toRet
+}
+
+func checkRemovals(t *testing.T, name string, got []removalEvent, exp ...removalEvent) {
+	t.Helper()
+	if len(got) != len(exp) {
+		t.Errorf("%s: expected %d removals, got %d: %v", name, len(exp), len(got), got)
+		return
+	}
+	found := make(map[removalEvent]bool)
+	for _, event := range got {
+		found[event] = true
+	}
+	for _, event := range exp {
+		if !found[event] {
+			t.Errorf("%s: expected removal %v, got %v", name, event, got)
+		}
+	}
+}
+
+func TestOnEvict(t *testing.T) {
+	recorder := new(removalRecorder)
+	myCache := NewCache(nil, NewTimedInvalidator(2*time.Second), WithMaxEntries(3))
+	myCache.OnEvict(recorder.record)
+
+	myCache.Put("foo", "foo")
+	myCache.Put("foo", "bar")
+	checkRemovals(t, "Put", recorder.take(), removalEvent{"foo", "foo", Replaced})
+
+	myCache.Remove("foo")
+	checkRemovals(t, "Remove", recorder.take(), removalEvent{"foo", "bar", Removed})
+
+	for _, key := range []string{"a", "b", "c", "d"} {
+		myCache.Put(key, key)
+	}
+	checkRemovals(t, "capacity", recorder.take(), removalEvent{"a", "a", Evicted})
+
+	myCache.Clear()
+	checkRemovals(
+		t, "Clear", recorder.take(),
+		removalEvent{"b", "b", Cleared},
+		removalEvent{"c", "c", Cleared},
+		removalEvent{"d", "d", Cleared},
+	)
+
+	myCache.PutWithTTL("foo", "foo", 100*time.Millisecond)
+	myCache.Put("bar", "bar")
+	time.Sleep(500 * time.Millisecond)
+	checkRemovals(t, "ttl", recorder.take(), removalEvent{"foo", "foo", Expired})
+	time.Sleep(3 * time.Second)
+	checkRemovals(t, "Invalidator", recorder.take(), removalEvent{"bar", "bar", Invalidated})
+
+	myCache.Put("foo", "foo")
+	myCache.Destroy()
+	checkRemovals(t, "Destroy", recorder.take(), removalEvent{"foo", "foo", Cleared})
+}
@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"sync"
+)
+
+// LenDataHandler is a DataHandler that can count its items without
+// ranging over them.
+type LenDataHandler interface {
+	DataHandler
+	// Len returns the number of items in the cache.
+	Len() int
+}
+
+// NewShardedDataHandler returns a DataHandler that hashes keys across shards
+// mutex protected maps, for write heavy workloads where a single sync.Map
+// struggles. shards < 1 defaults to 32.
+func NewShardedDataHandler(shards int) LenDataHandler {
+	if shards < 1 {
+		shards = 32
+	}
+	toRet := &sharded{
+		shards: make([]*shard, shards),
+	}
+	for i := range toRet.shards {
+		toRet.shards[i] = &shard{
+			items: make(map[string]interface{}),
+		}
+	}
+	return toRet
+}
+
+type sharded struct {
+	shards []*shard
+}
+
+type shard struct {
+	sync.RWMutex
+	items map[string]interface{}
+}
+
+// shardFor hashes key with 32 bit FNV-1a.
+func (s *sharded) shardFor(key string) *shard {
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= 16777619
+	}
+	return s.shards[hash%uint32(len(s.shards))]
+}
+
+func (s *sharded) Put(key string, data interface{}) error {
+	sh := s.shardFor(key)
+	sh.Lock()
+	sh.items[key] = data
+	sh.Unlock()
+	return nil
+}
+
+func (s *sharded) Get(key string) (interface{}, error) {
+	sh := s.shardFor(key)
+	sh.RLock()
+	toRet, ok := sh.items[key]
+	sh.RUnlock()
+	if !ok {
+		return nil, ValueNotPresentError{
+			Key: key,
+		}
+	}
+	return toRet, nil
+}
+
+func (s *sharded) Clear() error {
+	for _, sh := range s.shards {
+		sh.Lock()
+		sh.items = make(map[string]interface{})
+		sh.Unlock()
+	}
+	return nil
+}
+
+func (s *sharded) Remove(key string) error {
+	sh := s.shardFor(key)
+	sh.Lock()
+	defer sh.Unlock()
+	if _, ok := sh.items[key]; !ok {
+		return ValueNotPresentError{
+			Key: key,
+		}
+	}
+	delete(sh.items, key)
+	return nil
+}
+
+// Range copies each shard before calling f, so f is free to modify the
+// cache, the reaper removes items from within Range.
+func (s *sharded) Range(f func(string, interface{}) bool) {
+	type item struct {
+		key string
+		val interface{}
+	}
+	var items []item
+	for _, sh := range s.shards {
+		items = items[:0]
+		sh.RLock()
+		for key, val := range sh.items {
+			items = append(items, item{key, val})
+		}
+		sh.RUnlock()
+		for _, i := range items {
+			if !f(i.key, i.val) {
+				return
+			}
+		}
+	}
+}
+
+func (s *sharded) Len() int {
+	toRet := 0
+	for _, sh := range s.shards {
+		sh.RLock()
+		toRet += len(sh.items)
+		sh.RUnlock()
+	}
+	return toRet
+}
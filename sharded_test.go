@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestShardedDataHandler(t *testing.T) {
+	handler := NewShardedDataHandler(4)
+	myCache := NewCache(handler, nil)
+	defer myCache.Destroy()
+	for i := 0; i < 100; i++ {
+		myCache.Put(fmt.Sprintf("foo%d", i), i)
+	}
+	if handler.Len() != 100 {
+		t.Errorf("Len() expected %d, got %d", 100, handler.Len())
+	}
+	for i := 0; i < 100; i++ {
+		if found, err := myCache.Get(fmt.Sprintf("foo%d", i)); err != nil || found != i {
+			t.Errorf("Cacher.Get() expected %d, got '%#v', '%v'", i, found, err)
+		}
+	}
+	for i := 0; i < 50; i++ {
+		myCache.Remove(fmt.Sprintf("foo%d", i))
+	}
+	if _, err := handler.Get("foo0"); !IsValueNotPresentError(err) {
+		t.Errorf("Get() should have returned a ValueNotPresentError, got '%v'", err)
+	}
+	if err := handler.Remove("foo0"); !IsValueNotPresentError(err) {
+		t.Errorf("Remove() should have returned a ValueNotPresentError, got '%v'", err)
+	}
+	count := 0
+	handler.Range(func(key string, _ interface{}) bool {
+		// removing from within Range must not deadlock
+		handler.Remove(key)
+		count++
+		return true
+	})
+	if count != 50 || handler.Len() != 0 {
+		t.Errorf("Range() visited %d items, %d remain", count, handler.Len())
+	}
+}
+
+// BenchmarkDataHandler runs a read mostly Cacher workload, every Get writes
+// back its access metadata, against each DataHandler at increasing
+// goroutine counts.
+func BenchmarkDataHandler(b *testing.B) {
+	handlers := []struct {
+		name string
+		new  func() DataHandler
+	}{
+		{"inMemory", NewInMemoryDataHandler},
+		{"sharded", func() DataHandler { return NewShardedDataHandler(0) }},
+		{"arena", func() DataHandler { return NewArenaDataHandler(0, 0, nil) }},
+	}
+	const keys = 1024
+	for _, h := range handlers {
+		for _, goroutines := range []int{1, 4, 16, 64} {
+			name := fmt.Sprintf("handler=%s/goroutines=%d", h.name, goroutines)
+			b.Run(name, func(b *testing.B) {
+				myCache := NewCache(h.new(), nil)
+				defer myCache.Destroy()
+				for i := 0; i < keys; i++ {
+					myCache.Put(fmt.Sprintf("foo%d", i), i)
+				}
+				var wg sync.WaitGroup
+				b.ResetTimer()
+				for g := 0; g < goroutines; g++ {
+					wg.Add(1)
+					go func(g int) {
+						defer wg.Done()
+						for i := g; i < b.N; i += goroutines {
+							key := fmt.Sprintf("foo%d", i%keys)
+							if i%10 == 0 {
+								myCache.Put(key, i)
+							} else {
+								myCache.Get(key)
+							}
+						}
+					}(g)
+				}
+				wg.Wait()
+			})
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package cache
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"time"
+)
+
+// SnapshotVersion is the version of the format written by Cache.Snapshot.
+const SnapshotVersion = 1
+
+// snapshotHeader starts every snapshot, followed by a snapshotEntry per item.
+type snapshotHeader struct {
+	Version int
+}
+
+type snapshotEntry[K comparable, V any] struct {
+	Key         K
+	Value       V
+	Accessed    int64
+	Created     int64
+	Modified    int64
+	Expires     int64
+	Stale       int64
+	TTL         time.Duration
+	StaleWindow time.Duration
+	Extra       interface{}
+}
+
+// Snapshot writes every item in the cache and its Metadata to w with
+// encoding/gob. Concrete types held in interface{} values, including
+// Metadata.Extra, must be registered with RegisterType or gob.Register.
+func (c *cache[K, V]) Snapshot(w io.Writer) error {
+	enc := gob.NewEncoder(w)
+	if err := enc.Encode(snapshotHeader{SnapshotVersion}); err != nil {
+		return err
+	}
+	var err error
+	c.dataHandler.Range(func(key K, elem Element[V]) bool {
+		err = enc.Encode(snapshotEntry[K, V]{
+			Key:         key,
+			Value:       elem.data,
+			Accessed:    elem.metadata.Accessed,
+			Created:     elem.metadata.Created,
+			Modified:    elem.metadata.Modified,
+			Expires:     elem.metadata.Expires,
+			Stale:       elem.metadata.Stale,
+			TTL:         elem.metadata.TTL,
+			StaleWindow: elem.metadata.StaleWindow,
+			Extra:       elem.metadata.Extra,
+		})
+		return err == nil
+	})
+	return err
+}
+
+// Restore reads a snapshot written by Snapshot into the cache, keeping each
+// item's Metadata. Items that have expired or that the Invalidator no
+// longer considers valid are dropped, items already in the cache are
+// replaced.
+func (c *cache[K, V]) Restore(r io.Reader) error {
+	dec := gob.NewDecoder(r)
+	var header snapshotHeader
+	if err := dec.Decode(&header); err != nil {
+		return err
+	}
+	if header.Version != SnapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d", header.Version)
+	}
+	for {
+		var entry snapshotEntry[K, V]
+		if err := dec.Decode(&entry); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if err := c.restore(entry); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *cache[K, V]) restore(entry snapshotEntry[K, V]) error {
+	elem := Element[V]{
+		data: entry.Value,
+		metadata: Metadata{
+			KeyCount:    c.reaper.getCount(),
+			Accessed:    entry.Accessed,
+			Created:     entry.Created,
+			Modified:    entry.Modified,
+			Expires:     entry.Expires,
+			Stale:       entry.Stale,
+			TTL:         entry.TTL,
+			StaleWindow: entry.StaleWindow,
+			Extra:       entry.Extra,
+		},
+	}
+	if elem.metadata.expired(time.Now()) {
+		// even with the reaper paused
+		return nil
+	}
+	if _, expired := c.expiry(&elem.metadata, time.Now()); expired || !c.reaper.IsValid(&elem.metadata) {
+		return nil
+	}
+	cost, err := c.costOf(entry.Key, entry.Value)
+	if err != nil {
+		// it could never be in the cache
+		return nil
+	}
+	unlock := c.keys.lock(entry.Key)
+	found, err := c.dataHandler.Get(entry.Key)
+	if err != nil && !IsValueNotPresentError(err) {
+		unlock()
+		return err
+	}
+	replaced := err == nil
+	if err := c.dataHandler.Put(entry.Key, elem); err != nil {
+		unlock()
+		return err
+	}
+	if !replaced {
+		c.reaper.Adopt(&elem.metadata)
+		c.negatives.remove(entry.Key)
+	}
+	c.expiries.schedule(entry.Key, c.deadline(&elem.metadata))
+	c.lru.add(entry.Key, cost)
+	unlock()
+	if replaced {
+		c.removals.notify(entry.Key, found.data, Replaced)
+	}
+	c.evict()
+	return nil
+}
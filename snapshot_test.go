@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSnapshot(t *testing.T) {
+	myCache := NewCache(nil, NewTimedInvalidator(time.Hour))
+	defer myCache.Destroy()
+	for i := 0; i < 10; i++ {
+		myCache.Put(fmt.Sprintf("foo%d", i), i)
+	}
+	myCache.PutWithTTL("ttl", "bar", time.Hour)
+	myCache.PauseReaper()
+	myCache.PutWithTTL("stale", "baz", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	var buf bytes.Buffer
+	if err := myCache.Snapshot(&buf); err != nil {
+		t.Fatalf("Cacher.Snapshot() returned an error, %v", err)
+	}
+	snapshot := buf.Bytes()
+
+	t.Run("Restore", func(t *testing.T) {
+		restored := NewCache(nil, NewTimedInvalidator(time.Hour))
+		defer restored.Destroy()
+		restored.Put("foo0", "replaced")
+		if err := restored.Restore(bytes.NewReader(snapshot)); err != nil {
+			t.Fatalf("Cacher.Restore() returned an error, %v", err)
+		}
+		if entries := restored.Stats().Entries; entries != 11 {
+			t.Errorf("Cacher.Stats() expected %d entries, got %d", 11, entries)
+		}
+		for i := 0; i < 10; i++ {
+			if found, err := restored.Get(fmt.Sprintf("foo%d", i)); err != nil || found != i {
+				t.Errorf("Cacher.Get() expected %d, got '%#v', '%v'", i, found, err)
+			}
+		}
+		if _, err := restored.Get("stale"); !IsValueNotPresentError(err) {
+			t.Errorf("Cacher.Get() should have returned a ValueNotPresentError, got '%v'", err)
+		}
+		original, _ := myCache.(*cache[string, interface{}]).dataHandler.Get("ttl")
+		found, _ := restored.(*cache[string, interface{}]).dataHandler.Get("ttl")
+		if found.metadata.Created != original.metadata.Created || found.metadata.Expires != original.metadata.Expires {
+			t.Errorf("Cacher.Restore() expected metadata %v, got %v", original.metadata, found.metadata)
+		}
+	})
+
+	t.Run("Invalidator", func(t *testing.T) {
+		// every item is past this lifetime
+		restored := NewCache(nil, NewTimedInvalidator(-time.Hour))
+		defer restored.Destroy()
+		if err := restored.Restore(bytes.NewReader(snapshot)); err != nil {
+			t.Fatalf("Cacher.Restore() returned an error, %v", err)
+		}
+		if entries := restored.Stats().Entries; entries != 0 {
+			t.Errorf("Cacher.Stats() expected %d entries, got %d", 0, entries)
+		}
+	})
+
+	t.Run("version", func(t *testing.T) {
+		var buf bytes.Buffer
+		gob.NewEncoder(&buf).Encode(snapshotHeader{SnapshotVersion + 1})
+		if err := myCache.Restore(&buf); err == nil {
+			t.Errorf("Cacher.Restore() should have rejected an unknown version")
+		}
+	})
+
+	t.Run("TypedCache", func(t *testing.T) {
+		typed := NewTypedCache[int, string](nil, nil)
+		defer typed.Destroy()
+		typed.Put(1, "foo")
+		var buf bytes.Buffer
+		typed.Snapshot(&buf)
+		restored := NewTypedCache[int, string](nil, nil)
+		defer restored.Destroy()
+		if err := restored.Restore(&buf); err != nil {
+			t.Fatalf("Cache.Restore() returned an error, %v", err)
+		}
+		if found, err := restored.Get(1); err != nil || found != "foo" {
+			t.Errorf("Cache.Get() expected 'foo', got '%#v', '%v'", found, err)
+		}
+	})
+}
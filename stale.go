@@ -0,0 +1,24 @@
+package cache
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+func (c *cache[K, V]) PutWithStale(key K, data V, ttl, stale time.Duration) (V, error) {
+	return c.put(context.Background(), key, data, lifetime{ttl: ttl, stale: stale})
+}
+
+func (c *cache[K, V]) GetStale(key K) (V, bool, error) {
+	found, stale, err := c.lookup(context.Background(), key)
+	if err == nil {
+		atomic.AddInt64(&c.stats.hits, 1)
+	} else if IsValueNotPresentError(err) {
+		if negErr := c.negativeHit(key); negErr != nil {
+			return found.data, false, negErr
+		}
+		atomic.AddInt64(&c.stats.misses, 1)
+	}
+	return found.data, stale, err
+}
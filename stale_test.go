@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStale(t *testing.T) {
+	t.Run("revalidate", func(t *testing.T) {
+		myCache := NewCache(nil, nil)
+		defer myCache.Destroy()
+		var calls int32
+		release := make(chan int8)
+		myCache.SetLoader(func(context.Context, string) (interface{}, error) {
+			atomic.AddInt32(&calls, 1)
+			<-release
+			return "new", nil
+		})
+		myCache.PutWithStale("foo", "old", time.Millisecond, time.Hour)
+		if found, stale, err := myCache.GetStale("foo"); err != nil || found != "old" || stale {
+			t.Errorf("Cacher.GetStale() expected a fresh 'old', got '%#v', %t, '%v'", found, stale, err)
+		}
+		time.Sleep(5 * time.Millisecond)
+		for i := 0; i < 10; i++ {
+			if found, stale, err := myCache.GetStale("foo"); err != nil || found != "old" || !stale {
+				t.Errorf("Cacher.GetStale() expected a stale 'old', got '%#v', %t, '%v'", found, stale, err)
+			}
+		}
+		if found, err := myCache.Get("foo"); err != nil || found != "old" {
+			t.Errorf("Cacher.Get() expected 'old', got '%#v', '%v'", found, err)
+		}
+		close(release)
+		if !waitFor(func() bool { found, _, _ := myCache.GetStale("foo"); return found == "new" }) {
+			t.Errorf("Cacher.GetStale() never returned the revalidated value")
+		}
+		if n := atomic.LoadInt32(&calls); n < 1 || n > 2 {
+			t.Errorf("expected one revalidation at a time, got %d loader calls", n)
+		}
+		found, _ := myCache.(*cache[string, interface{}]).dataHandler.Get("foo")
+		if found.metadata.Stale == 0 || found.metadata.Expires-found.metadata.Stale < int64(59*time.Minute) {
+			t.Errorf("the revalidated item should keep its stale window, got %v", found.metadata)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		myCache := NewCache(nil, nil)
+		defer myCache.Destroy()
+		myCache.SetLoader(func(context.Context, string) (interface{}, error) {
+			return nil, errors.New("load failed")
+		})
+		myCache.PutWithStale("foo", "old", time.Millisecond, 50*time.Millisecond)
+		time.Sleep(5 * time.Millisecond)
+		if found, stale, err := myCache.GetStale("foo"); err != nil || found != "old" || !stale {
+			t.Errorf("Cacher.GetStale() expected a stale 'old', got '%#v', %t, '%v'", found, stale, err)
+		}
+		if !waitFor(func() bool { return myCache.Stats().RefreshErrors > 0 }) {
+			t.Errorf("Cacher.Stats() expected a refresh error, got %+v", myCache.Stats())
+		}
+		if found, _, err := myCache.GetStale("foo"); err != nil || found != "old" {
+			t.Errorf("Cacher.GetStale() expected 'old' after a failed revalidation, got '%#v', '%v'", found, err)
+		}
+		time.Sleep(60 * time.Millisecond)
+		if _, _, err := myCache.GetStale("foo"); !IsValueNotPresentError(err) {
+			t.Errorf("Cacher.GetStale() should have returned a ValueNotPresentError past the stale window, got '%v'", err)
+		}
+	})
+
+	t.Run("shortTTL", func(t *testing.T) {
+		ttl, _ := time.ParseDuration("10ms")
+		myCache := NewCache(nil, nil)
+		defer myCache.Destroy()
+		myCache.SetLoader(func(context.Context, string) (interface{}, error) {
+			return "new", nil
+		})
+		myCache.PutWithStale("foo", "old", ttl, time.Hour)
+		time.Sleep(2 * ttl)
+		myCache.GetStale("foo")
+		if !waitFor(func() bool { found, _, _ := myCache.GetStale("foo"); return found == "new" }) {
+			t.Fatalf("Cacher.GetStale() never returned the revalidated value")
+		}
+		found, _ := myCache.(*cache[string, interface{}]).dataHandler.Get("foo")
+		if fresh := time.Until(time.Unix(0, found.metadata.Stale)); fresh > ttl {
+			t.Errorf("the revalidated item should be fresh for %v, got %v", ttl, fresh)
+		}
+	})
+
+	t.Run("backoff", func(t *testing.T) {
+		ttl, _ := time.ParseDuration("200ms")
+		myCache := NewCache(nil, nil)
+		defer myCache.Destroy()
+		var calls int32
+		myCache.SetLoader(func(context.Context, string) (interface{}, error) {
+			atomic.AddInt32(&calls, 1)
+			return nil, errors.New("load failed")
+		})
+		myCache.PutWithStale("foo", "old", ttl, time.Hour)
+		time.Sleep(ttl + 10*time.Millisecond)
+		myCache.GetStale("foo")
+		if !waitFor(func() bool { return myCache.Stats().RefreshErrors == 1 }) {
+			t.Fatalf("Cacher.Stats() expected a refresh error, got %+v", myCache.Stats())
+		}
+		for i := 0; i < 20; i++ {
+			myCache.GetStale("foo")
+			myCache.Get("foo")
+		}
+		time.Sleep(10 * time.Millisecond)
+		if n := atomic.LoadInt32(&calls); n != 1 {
+			t.Errorf("a failed revalidation should not be retried right away, got %d loader calls", n)
+		}
+		time.Sleep(ttl)
+		myCache.GetStale("foo")
+		if !waitFor(func() bool { return atomic.LoadInt32(&calls) == 2 }) {
+			t.Errorf("a failed revalidation should be retried after the ttl, got %d loader calls", atomic.LoadInt32(&calls))
+		}
+	})
+
+	t.Run("overwrite", func(t *testing.T) {
+		myCache := NewCache(nil, nil)
+		defer myCache.Destroy()
+		myCache.PutWithStale("foo", "old", time.Millisecond, time.Hour)
+		myCache.Put("foo", "new")
+		time.Sleep(5 * time.Millisecond)
+		if found, stale, err := myCache.GetStale("foo"); err != nil || found != "new" || stale {
+			t.Errorf("Put() should have cleared the stale window, got '%#v', %t, '%v'", found, stale, err)
+		}
+	})
+}
@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"sync/atomic"
+)
+
+// Stats is a snapshot of a cache's counters, returned by Cache.Stats.
+// Every field but Entries counts events since the cache was created or
+// Cache.ResetStats was last called.
+type Stats struct {
+	// Hits is the number of Get calls that found an item.
+	Hits int64
+	// Misses is the number of Get calls that found nothing, including
+	// those that went on to insert a default or call a Loader.
+	Misses int64
+	// GetInserts is the number of defaults inserted by Get and GetWithTTL.
+	GetInserts int64
+	// Puts is the number of items stored with Put, PutWithTTL or by a Loader.
+	Puts int64
+	// Overwrites is the number of Puts that replaced an existing item.
+	Overwrites int64
+	// Removes is the number of items removed with Remove.
+	Removes int64
+	// Expirations is the number of items the reaper removed because their
+	// ttl passed or the Invalidator found them invalid.
+	Expirations int64
+	// Evictions is the number of items removed to keep the cache within
+	// its capacity.
+	Evictions int64
+	// LoaderCalls is the number of times a Loader ran.
+	LoaderCalls int64
+	// LoaderErrors is the number of times a Loader returned an error.
+	LoaderErrors int64
+	// Refreshes is the number of background reloads started by
+	// WithRefreshAhead.
+	Refreshes int64
+	// RefreshErrors is the number of background reloads that failed, the
+	// item kept its current value.
+	RefreshErrors int64
+	// NegativeHits is the number of lookups answered with a
+	// NegativeCacheHitError, see WithNegativeCaching.
+	NegativeHits int64
+	// NegativeInserts is the number of loader misses cached as not found.
+	NegativeInserts int64
+	// Entries is the number of items in the cache, the same count as
+	// Metadata.KeyCount.
+	Entries int64
+	// NegativeEntries is the number of keys cached as not found, including
+	// those past their ttl that the reaper hasn't dropped yet.
+	NegativeEntries int64
+}
+
+// HitRatio is Hits over all lookups, 0 when there were none.
+func (s Stats) HitRatio() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+// statsCounter holds the counters behind Stats, all updated atomically.
+type statsCounter struct {
+	hits            int64
+	misses          int64
+	getInserts      int64
+	puts            int64
+	overwrites      int64
+	removes         int64
+	expirations     int64
+	evictions       int64
+	loaderCalls     int64
+	loaderErrors    int64
+	refreshes       int64
+	refreshErrors   int64
+	negativeHits    int64
+	negativeInserts int64
+}
+
+func (s *statsCounter) snapshot() Stats {
+	return Stats{
+		Hits:            atomic.LoadInt64(&s.hits),
+		Misses:          atomic.LoadInt64(&s.misses),
+		GetInserts:      atomic.LoadInt64(&s.getInserts),
+		Puts:            atomic.LoadInt64(&s.puts),
+		Overwrites:      atomic.LoadInt64(&s.overwrites),
+		Removes:         atomic.LoadInt64(&s.removes),
+		Expirations:     atomic.LoadInt64(&s.expirations),
+		Evictions:       atomic.LoadInt64(&s.evictions),
+		LoaderCalls:     atomic.LoadInt64(&s.loaderCalls),
+		LoaderErrors:    atomic.LoadInt64(&s.loaderErrors),
+		Refreshes:       atomic.LoadInt64(&s.refreshes),
+		RefreshErrors:   atomic.LoadInt64(&s.refreshErrors),
+		NegativeHits:    atomic.LoadInt64(&s.negativeHits),
+		NegativeInserts: atomic.LoadInt64(&s.negativeInserts),
+	}
+}
+
+func (s *statsCounter) reset() {
+	for _, counter := range []*int64{
+		&s.hits, &s.misses, &s.getInserts, &s.puts, &s.overwrites,
+		&s.removes, &s.expirations, &s.evictions, &s.loaderCalls,
+		&s.loaderErrors, &s.refreshes, &s.refreshErrors, &s.negativeHits,
+		&s.negativeInserts,
+	} {
+		atomic.StoreInt64(counter, 0)
+	}
+}
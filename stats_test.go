@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	myCache := NewCache(nil, nil, WithMaxEntries(3))
+	defer myCache.Destroy()
+	myCache.Put("foo", "foo")
+	myCache.Put("foo", "bar")
+	myCache.Get("foo")
+	myCache.Get("bar")
+	myCache.Get("bar", "bar")
+	myCache.Remove("bar")
+	myCache.PutWithTTL("baz", "baz", time.Millisecond)
+	loader := func(context.Context) (interface{}, error) {
+		return "qux", nil
+	}
+	myCache.GetOrLoad(context.Background(), "qux", loader)
+	failing := func(context.Context) (interface{}, error) {
+		return nil, errors.New("load failed")
+	}
+	myCache.GetOrLoad(context.Background(), "quux", failing)
+	myCache.Put("a", "a")
+	time.Sleep(300 * time.Millisecond)
+	exp := Stats{
+		Hits:         1,
+		Misses:       4,
+		GetInserts:   1,
+		Puts:         5,
+		Overwrites:   1,
+		Removes:      1,
+		Expirations:  1,
+		Evictions:    1,
+		LoaderCalls:  2,
+		LoaderErrors: 1,
+		Entries:      2,
+	}
+	if got := myCache.Stats(); got != exp {
+		t.Errorf("Cacher.Stats() expected\n%+v\ngot\n%+v", exp, got)
+	}
+	if ratio := myCache.Stats().HitRatio(); ratio != .2 {
+		t.Errorf("Stats.HitRatio() expected %f, got %f", .2, ratio)
+	}
+	myCache.ResetStats()
+	if got := myCache.Stats(); got != (Stats{Entries: 2}) {
+		t.Errorf("Cacher.ResetStats() should only keep Entries, got\n%+v", got)
+	}
+}
+
+// yieldingHandler yields between reading an item and anything written
+// after, so concurrent calls on a key interleave even on a single CPU.
+type yieldingHandler struct {
+	DataHandler
+}
+
+func (y yieldingHandler) Get(key string) (interface{}, error) {
+	defer runtime.Gosched()
+	return y.DataHandler.Get(key)
+}
+
+func TestStatsConcurrent(t *testing.T) {
+	myCache := NewCache(yieldingHandler{NewInMemoryDataHandler()}, nil)
+	defer myCache.Destroy()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				key := fmt.Sprintf("foo%d", j%10)
+				switch (i + j) % 4 {
+				case 0:
+					myCache.Put(key, j)
+				case 1:
+					myCache.Get(key, j)
+				case 2:
+					myCache.PutMany(map[string]interface{}{key: j})
+				default:
+					myCache.Remove(key)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	present := 0
+	for j := 0; j < 10; j++ {
+		if _, err := myCache.Get(fmt.Sprintf("foo%d", j)); err == nil {
+			present++
+		}
+	}
+	if entries := myCache.Stats().Entries; entries != int64(present) {
+		t.Errorf("Cacher.Stats() expected %d entries, got %d", present, entries)
+	}
+}
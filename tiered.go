@@ -0,0 +1,493 @@
+package cache
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// TieredOption configures a tiered cache, passed to NewTieredCache or
+// NewTypedTieredCache.
+type TieredOption func(*tieredOptions)
+
+type tieredOptions struct {
+	writeBack bool
+}
+
+// WithWriteBack makes a tiered cache write only to its first tier, items
+// are written to the second tier when they leave the first for any reason
+// but their own ttl passing, with what is left of that ttl. By default
+// writes go to both tiers.
+func WithWriteBack() TieredOption {
+	return func(o *tieredOptions) {
+		o.writeBack = true
+	}
+}
+
+// NewTieredCache returns a Cacher over a small, fast first tier l1 and a
+// larger, slower second tier l2, such as one backed by NewLogDataHandler.
+// Each tier keeps its own Invalidator and options. Lookups try l1, then
+// l2, copying l2 hits into l1 with what is left of their lifetime. Writes
+// go to both tiers unless WithWriteBack is given.
+//
+// OnEvict reports items leaving l2. Stats adds up the counters of both tiers,
+// except that a lookup missing l1 but hitting l2 is a hit: Misses are those
+// of l2 and Entries and NegativeEntries are the larger of the two.
+func NewTieredCache(l1, l2 Cacher, opts ...TieredOption) Cacher {
+	return newTiered[string, interface{}](l1, l2, opts)
+}
+
+// NewTypedTieredCache is the generic counterpart of NewTieredCache.
+func NewTypedTieredCache[K comparable, V any](
+	l1, l2 Cache[K, V], opts ...TieredOption,
+) Cache[K, V] {
+	return newTiered[K, V](l1, l2, opts)
+}
+
+func newTiered[K comparable, V any](l1, l2 Cache[K, V], opts []TieredOption) *tiered[K, V] {
+	config := &tieredOptions{}
+	for _, opt := range opts {
+		opt(config)
+	}
+	toRet := &tiered[K, V]{
+		l1:        l1,
+		l2:        l2,
+		writeBack: config.writeBack,
+		dirty:     make(map[K]dirtyItem),
+	}
+	if toRet.writeBack {
+		l1.OnEvict(toRet.writeOut)
+	}
+	return toRet
+}
+
+// lifetimeCache is implemented by the caches of NewCache and NewTypedCache,
+// a tier implementing it promotes items with what is left of their
+// lifetime rather than none.
+type lifetimeCache[K comparable, V any] interface {
+	getElement(ctx context.Context, key K) (Element[V], error)
+	getManyElements(keys []K) (map[K]Element[V], []K, error)
+	getOrLoad(ctx context.Context, key K, loader lifetimeLoader[V]) (V, error)
+	load(ctx context.Context, key K, loader lifetimeLoader[V]) (V, error)
+}
+
+type tiered[K comparable, V any] struct {
+	l1, l2    Cache[K, V]
+	writeBack bool
+	// dirty holds the keys written to l1 and not yet to l2 when writeBack
+	// is set.
+	dirty map[K]dirtyItem
+	sync.Mutex
+}
+
+// dirtyItem is the lifetime a dirty key was written to l1 with, and when.
+type dirtyItem struct {
+	life    lifetime
+	written time.Time
+}
+
+// remaining is what is left of the item's lifetime at now, false once it
+// has expired. An item in its stale window keeps only its time to expire.
+func (d dirtyItem) remaining(now time.Time) (lifetime, bool) {
+	if d.life.ttl <= 0 {
+		return lifetime{}, true
+	}
+	elapsed := now.Sub(d.written)
+	end := d.life.ttl + d.life.stale
+	if elapsed >= end {
+		return lifetime{}, false
+	}
+	if elapsed < d.life.ttl {
+		return lifetime{ttl: d.life.ttl - elapsed, stale: d.life.stale}, true
+	}
+	return lifetime{ttl: end - elapsed}, true
+}
+
+// writeOut writes an item leaving l1 to l2 if l2 hasn't got it. Items
+// expiring by their own ttl are dropped rather than revived in l2.
+func (t *tiered[K, V]) writeOut(key K, val V, reason RemovalReason) {
+	switch reason {
+	case Expired:
+		t.clean(key)
+	case Invalidated, Evicted, Cleared:
+		item, ok := t.clean(key)
+		if !ok {
+			return
+		}
+		if life, live := item.remaining(time.Now()); live {
+			t.write(context.Background(), t.l2, key, val, life)
+		}
+	}
+}
+
+func (t *tiered[K, V]) markDirty(key K, life lifetime) {
+	if !t.writeBack {
+		return
+	}
+	t.Lock()
+	t.dirty[key] = dirtyItem{life: life, written: time.Now()}
+	t.Unlock()
+}
+
+// clean unmarks key, returning how it was written if it was dirty.
+func (t *tiered[K, V]) clean(key K) (dirtyItem, bool) {
+	t.Lock()
+	defer t.Unlock()
+	item, ok := t.dirty[key]
+	delete(t.dirty, key)
+	return item, ok
+}
+
+// flush writes every dirty item to l2, keeping what is left of its
+// lifetime.
+func (t *tiered[K, V]) flush() error {
+	t.Lock()
+	dirty := t.dirty
+	t.dirty = make(map[K]dirtyItem)
+	t.Unlock()
+	if len(dirty) == 0 {
+		return nil
+	}
+	keys := make([]K, 0, len(dirty))
+	for key := range dirty {
+		keys = append(keys, key)
+	}
+	found, _, err := t.l1.GetMany(keys)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	forever := make(map[K]V, len(found))
+	for key, val := range found {
+		life, live := dirty[key].remaining(now)
+		if !live {
+			continue
+		}
+		if life.ttl <= 0 {
+			forever[key] = val
+			continue
+		}
+		if _, err := t.write(context.Background(), t.l2, key, val, life); err != nil {
+			return err
+		}
+	}
+	if len(forever) == 0 {
+		return nil
+	}
+	return t.l2.PutMany(forever)
+}
+
+func (t *tiered[K, V]) Clear() {
+	t.Lock()
+	t.dirty = make(map[K]dirtyItem)
+	t.Unlock()
+	t.l1.Clear()
+	t.l2.Clear()
+}
+
+func (t *tiered[K, V]) Get(key K, data ...V) (V, error) {
+	return t.GetContext(context.Background(), key, data...)
+}
+
+func (t *tiered[K, V]) GetWithTTL(key K, data V, ttl time.Duration) (V, error) {
+	found, err := t.lookup(context.Background(), key)
+	if err == nil || !IsValueNotPresentError(err) {
+		return found, err
+	}
+	if _, err := t.put(context.Background(), key, data, lifetime{ttl: ttl}); err != nil {
+		return found, err
+	}
+	return data, nil
+}
+
+func (t *tiered[K, V]) GetContext(ctx context.Context, key K, data ...V) (V, error) {
+	found, err := t.lookup(ctx, key)
+	if err == nil || !IsValueNotPresentError(err) || len(data) == 0 {
+		return found, err
+	}
+	if _, err := t.put(ctx, key, data[0], lifetime{}); err != nil {
+		return found, err
+	}
+	return data[0], nil
+}
+
+// lookup tries l1, then l2, copying an l2 hit into l1.
+func (t *tiered[K, V]) lookup(ctx context.Context, key K) (V, error) {
+	found, err := t.l1.GetContext(ctx, key)
+	if err == nil || !IsValueNotPresentError(err) {
+		return found, err
+	}
+	elem, life, err := t.fromL2(ctx, key)
+	if err != nil {
+		return elem, err
+	}
+	t.write(ctx, t.l1, key, elem, life)
+	return elem, nil
+}
+
+// fromL2 gets key from l2 along with what is left of its lifetime.
+func (t *tiered[K, V]) fromL2(ctx context.Context, key K) (V, lifetime, error) {
+	l2, ok := t.l2.(lifetimeCache[K, V])
+	if !ok {
+		found, err := t.l2.GetContext(ctx, key)
+		return found, lifetime{}, err
+	}
+	found, err := l2.getElement(ctx, key)
+	if err != nil {
+		return found.data, lifetime{}, err
+	}
+	life, live := found.metadata.remainingLifetime(time.Now())
+	if !live {
+		var zero V
+		return zero, lifetime{}, ValueNotPresentError{Key: keyString(key)}
+	}
+	return found.data, life, nil
+}
+
+// GetStale tries l1, then l2, copying a fresh l2 hit into l1.
+func (t *tiered[K, V]) GetStale(key K) (V, bool, error) {
+	found, stale, err := t.l1.GetStale(key)
+	if err == nil || !IsValueNotPresentError(err) {
+		return found, stale, err
+	}
+	found, stale, err = t.l2.GetStale(key)
+	if err != nil {
+		return found, stale, err
+	}
+	if !stale {
+		t.l1.Put(key, found)
+	}
+	return found, stale, nil
+}
+
+func (t *tiered[K, V]) GetOrLoad(ctx context.Context, key K, loader Loader[V]) (V, error) {
+	l1, ok1 := t.l1.(lifetimeCache[K, V])
+	l2, ok2 := t.l2.(lifetimeCache[K, V])
+	if !ok1 || !ok2 {
+		return t.l1.GetOrLoad(ctx, key, func(ctx context.Context) (V, error) {
+			return t.l2.GetOrLoad(ctx, key, loader)
+		})
+	}
+	return l1.getOrLoad(ctx, key, func(ctx context.Context) (V, lifetime, error) {
+		found, life, err := t.fromL2(ctx, key)
+		if err == nil || !IsValueNotPresentError(err) {
+			return found, life, err
+		}
+		found, err = l2.load(ctx, key, func(ctx context.Context) (V, lifetime, error) {
+			val, err := loader(ctx)
+			return val, lifetime{}, err
+		})
+		return found, lifetime{}, err
+	})
+}
+
+func (t *tiered[K, V]) Put(key K, data V) (V, error) {
+	return t.put(context.Background(), key, data, lifetime{})
+}
+
+func (t *tiered[K, V]) PutWithTTL(key K, data V, ttl time.Duration) (V, error) {
+	return t.put(context.Background(), key, data, lifetime{ttl: ttl})
+}
+
+func (t *tiered[K, V]) PutWithStale(key K, data V, ttl, stale time.Duration) (V, error) {
+	return t.put(context.Background(), key, data, lifetime{ttl: ttl, stale: stale})
+}
+
+func (t *tiered[K, V]) PutContext(ctx context.Context, key K, data V) (V, error) {
+	return t.put(ctx, key, data, lifetime{})
+}
+
+// put writes to l1, and to l2 first unless writeBack is set. A ttl > 0
+// and a stale window apply to both tiers.
+func (t *tiered[K, V]) put(ctx context.Context, key K, data V, life lifetime) (V, error) {
+	if t.writeBack {
+		t.markDirty(key, life)
+		return t.write(ctx, t.l1, key, data, life)
+	}
+	toRet, err := t.write(ctx, t.l2, key, data, life)
+	if err != nil {
+		return toRet, err
+	}
+	_, err = t.write(ctx, t.l1, key, data, life)
+	return toRet, err
+}
+
+// write puts data in c with life.
+func (t *tiered[K, V]) write(ctx context.Context, c Cache[K, V], key K, data V, life lifetime) (V, error) {
+	if life.stale > 0 {
+		return c.PutWithStale(key, data, life.ttl, life.stale)
+	}
+	if life.ttl > 0 {
+		return c.PutWithTTL(key, data, life.ttl)
+	}
+	return c.PutContext(ctx, key, data)
+}
+
+func (t *tiered[K, V]) GetMany(keys []K) (map[K]V, []K, error) {
+	found, missing, err := t.l1.GetMany(keys)
+	if err != nil || len(missing) == 0 {
+		return found, missing, err
+	}
+	l2, ok := t.l2.(lifetimeCache[K, V])
+	if !ok {
+		promoted, missing, err := t.l2.GetMany(missing)
+		if err != nil {
+			return found, missing, err
+		}
+		if len(promoted) > 0 {
+			t.l1.PutMany(promoted)
+		}
+		for key, val := range promoted {
+			found[key] = val
+		}
+		return found, missing, nil
+	}
+	promoted, missing, err := l2.getManyElements(missing)
+	if err != nil {
+		return found, missing, err
+	}
+	now := time.Now()
+	forever := make(map[K]V, len(promoted))
+	for key, elem := range promoted {
+		life, live := elem.metadata.remainingLifetime(now)
+		if !live {
+			missing = append(missing, key)
+			continue
+		}
+		found[key] = elem.data
+		if life.ttl <= 0 {
+			forever[key] = elem.data
+			continue
+		}
+		t.write(context.Background(), t.l1, key, elem.data, life)
+	}
+	if len(forever) > 0 {
+		t.l1.PutMany(forever)
+	}
+	return found, missing, nil
+}
+
+func (t *tiered[K, V]) PutMany(items map[K]V) error {
+	if t.writeBack {
+		for key := range items {
+			t.markDirty(key, lifetime{})
+		}
+		return t.l1.PutMany(items)
+	}
+	if err := t.l2.PutMany(items); err != nil {
+		return err
+	}
+	return t.l1.PutMany(items)
+}
+
+func (t *tiered[K, V]) Remove(key K) (V, error) {
+	return t.RemoveContext(context.Background(), key)
+}
+
+func (t *tiered[K, V]) RemoveMany(keys []K) error {
+	for _, key := range keys {
+		t.clean(key)
+	}
+	if err := t.l1.RemoveMany(keys); err != nil {
+		return err
+	}
+	return t.l2.RemoveMany(keys)
+}
+
+// RemoveContext removes key from both tiers, returning l1's value if it
+// had one.
+func (t *tiered[K, V]) RemoveContext(ctx context.Context, key K) (V, error) {
+	t.clean(key)
+	found1, err1 := t.l1.RemoveContext(ctx, key)
+	found2, err2 := t.l2.RemoveContext(ctx, key)
+	if err1 != nil && !IsValueNotPresentError(err1) {
+		return found1, err1
+	}
+	if err1 == nil {
+		return found1, nil
+	}
+	return found2, err2
+}
+
+// Destroy writes any dirty items to l2, then destroys both tiers.
+func (t *tiered[K, V]) Destroy() {
+	t.flush()
+	t.l1.Destroy()
+	t.l2.Destroy()
+}
+
+// SetLoader sets loader on l2, l1 reloads through l2.
+func (t *tiered[K, V]) SetLoader(loader KeyLoader[K, V]) {
+	t.l2.SetLoader(loader)
+	if loader == nil {
+		t.l1.SetLoader(nil)
+		return
+	}
+	t.l1.SetLoader(func(ctx context.Context, key K) (V, error) {
+		return t.l2.GetOrLoad(ctx, key, func(ctx context.Context) (V, error) {
+			return loader(ctx, key)
+		})
+	})
+}
+
+func (t *tiered[K, V]) OnEvict(f func(K, V, RemovalReason)) {
+	t.l2.OnEvict(f)
+}
+
+func (t *tiered[K, V]) Stats() Stats {
+	s1, s2 := t.l1.Stats(), t.l2.Stats()
+	toRet := Stats{
+		Hits:            s1.Hits + s2.Hits,
+		Misses:          s2.Misses,
+		GetInserts:      s1.GetInserts + s2.GetInserts,
+		Puts:            s1.Puts + s2.Puts,
+		Overwrites:      s1.Overwrites + s2.Overwrites,
+		Removes:         s1.Removes + s2.Removes,
+		Expirations:     s1.Expirations + s2.Expirations,
+		Evictions:       s1.Evictions + s2.Evictions,
+		LoaderCalls:     s1.LoaderCalls + s2.LoaderCalls,
+		LoaderErrors:    s1.LoaderErrors + s2.LoaderErrors,
+		Refreshes:       s1.Refreshes + s2.Refreshes,
+		RefreshErrors:   s1.RefreshErrors + s2.RefreshErrors,
+		NegativeHits:    s1.NegativeHits + s2.NegativeHits,
+		NegativeInserts: s1.NegativeInserts + s2.NegativeInserts,
+		Entries:         s1.Entries,
+		NegativeEntries: s1.NegativeEntries,
+	}
+	if s2.Entries > toRet.Entries {
+		toRet.Entries = s2.Entries
+	}
+	if s2.NegativeEntries > toRet.NegativeEntries {
+		toRet.NegativeEntries = s2.NegativeEntries
+	}
+	return toRet
+}
+
+func (t *tiered[K, V]) ResetStats() {
+	t.l1.ResetStats()
+	t.l2.ResetStats()
+}
+
+func (t *tiered[K, V]) PauseReaper() {
+	t.l1.PauseReaper()
+	t.l2.PauseReaper()
+}
+
+func (t *tiered[K, V]) ResumeReaper() {
+	t.l1.ResumeReaper()
+	t.l2.ResumeReaper()
+}
+
+// Snapshot writes dirty items to l2, then snapshots l2.
+func (t *tiered[K, V]) Snapshot(w io.Writer) error {
+	if err := t.flush(); err != nil {
+		return err
+	}
+	return t.l2.Snapshot(w)
+}
+
+// Restore restores into l2, l1 fills up again as items are looked up.
+func (t *tiered[K, V]) Restore(r io.Reader) error {
+	return t.l2.Restore(r)
+}
@@ -0,0 +1,149 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTieredCache(t *testing.T) {
+	t.Run("WriteThrough", func(t *testing.T) {
+		l1 := NewCache(nil, NewTimedInvalidator(time.Hour), WithMaxEntries(2))
+		l2 := NewCache(nil, nil)
+		myCache := NewTieredCache(l1, l2)
+		defer myCache.Destroy()
+		for i := 0; i < 5; i++ {
+			myCache.Put(fmt.Sprintf("foo%d", i), i)
+		}
+		if l1.Stats().Entries != 2 || l2.Stats().Entries != 5 {
+			t.Errorf("expected %d and %d entries, got %d and %d", 2, 5, l1.Stats().Entries, l2.Stats().Entries)
+		}
+		if found, err := myCache.Get("foo0"); err != nil || found != 0 {
+			t.Errorf("Cacher.Get() expected %d, got '%#v', '%v'", 0, found, err)
+		}
+		// the l2 hit was promoted
+		if found, err := l1.Get("foo0"); err != nil || found != 0 {
+			t.Errorf("l1 Get() expected %d, got '%#v', '%v'", 0, found, err)
+		}
+		if _, err := myCache.Get("bar"); !IsValueNotPresentError(err) {
+			t.Errorf("Cacher.Get() should have returned a ValueNotPresentError, got '%v'", err)
+		}
+		// the l1 Get above counts too
+		stats := myCache.Stats()
+		if stats.Hits != 2 || stats.Misses != 1 || stats.Entries != 5 {
+			t.Errorf("Cacher.Stats() expected 2 hits, 1 miss and 5 entries, got %+v", stats)
+		}
+		found, missing, err := myCache.GetMany([]string{"foo1", "foo4", "bar"})
+		if err != nil || len(found) != 2 || len(missing) != 1 {
+			t.Errorf("Cacher.GetMany() expected 2 found, 1 missing, got %v, %v, '%v'", found, missing, err)
+		}
+		if _, err := myCache.Remove("foo1"); err != nil {
+			t.Errorf("Cacher.Remove() returned an error, %v", err)
+		}
+		if _, err := l2.Get("foo1"); !IsValueNotPresentError(err) {
+			t.Errorf("Cacher.Remove() should have removed from both tiers, got '%v'", err)
+		}
+		if _, err := myCache.Remove("foo1"); !IsValueNotPresentError(err) {
+			t.Errorf("Cacher.Remove() should have returned a ValueNotPresentError, got '%v'", err)
+		}
+	})
+
+	t.Run("WriteBack", func(t *testing.T) {
+		l1 := NewCache(nil, nil, WithMaxEntries(2))
+		l2 := NewCache(nil, nil)
+		myCache := NewTieredCache(l1, l2, WithWriteBack())
+		myCache.Put("foo0", 0)
+		if _, err := l2.Get("foo0"); !IsValueNotPresentError(err) {
+			t.Errorf("a write back Put() should not reach l2, got '%v'", err)
+		}
+		myCache.Put("foo1", 1)
+		myCache.Put("foo2", 2)
+		// foo0 was evicted from l1 into l2
+		if found, err := l2.Get("foo0"); err != nil || found != 0 {
+			t.Errorf("l2 Get() expected %d, got '%#v', '%v'", 0, found, err)
+		}
+		var buf bytes.Buffer
+		if err := myCache.Snapshot(&buf); err != nil {
+			t.Fatalf("Cacher.Snapshot() returned an error, %v", err)
+		}
+		if l2.Stats().Entries != 3 {
+			t.Errorf("Cacher.Snapshot() should have flushed l1, l2 has %d entries", l2.Stats().Entries)
+		}
+		myCache.Put("foo3", 3)
+		removals := &removalRecorder{}
+		l2.OnEvict(removals.record)
+		myCache.Destroy()
+		flushed := false
+		for _, event := range removals.take() {
+			flushed = flushed || event.key == "foo3" && event.reason == Cleared
+		}
+		if !flushed {
+			t.Errorf("Cacher.Destroy() should have flushed foo3 to l2 before clearing it")
+		}
+	})
+
+	t.Run("WriteBackTTL", func(t *testing.T) {
+		ttl, _ := time.ParseDuration("50ms")
+		l1 := NewCache(nil, nil, WithMaxEntries(1), WithReaperInterval(ttl/10))
+		l2 := NewCache(nil, nil, WithReaperInterval(ttl/10))
+		myCache := NewTieredCache(l1, l2, WithWriteBack())
+		defer myCache.Destroy()
+		myCache.PutWithTTL("foo", "foo", ttl)
+		myCache.PutWithTTL("bar", "bar", ttl)
+		// foo was evicted from l1 into l2 with what was left of its ttl
+		if found, err := l2.Get("foo"); err != nil || found != "foo" {
+			t.Errorf("l2 Get() expected '%s', got '%#v', '%v'", "foo", found, err)
+		}
+		time.Sleep(3 * ttl)
+		for _, key := range []string{"foo", "bar"} {
+			if found, err := myCache.Get(key); !IsValueNotPresentError(err) {
+				t.Errorf("an item past its ttl should be gone from both tiers, got '%#v', '%v'", found, err)
+			}
+		}
+	})
+
+	t.Run("PromoteTTL", func(t *testing.T) {
+		ttl, _ := time.ParseDuration("300ms")
+		l1 := NewCache(nil, nil, WithMaxEntries(3))
+		l2 := NewCache(nil, nil)
+		myCache := NewTieredCache(l1, l2)
+		defer myCache.Destroy()
+		for _, key := range []string{"foo", "bar", "baz"} {
+			myCache.PutWithTTL(key, key, ttl)
+		}
+		for i := 0; i < 3; i++ {
+			myCache.Put(fmt.Sprintf("qux%d", i), i)
+		}
+		// foo, bar and baz were evicted from l1 and are promoted from l2
+		myCache.Get("foo")
+		myCache.GetMany([]string{"bar"})
+		myCache.GetOrLoad(context.Background(), "baz", func(context.Context) (interface{}, error) {
+			return "loaded", nil
+		})
+		time.Sleep(2 * ttl)
+		for _, key := range []string{"foo", "bar", "baz"} {
+			if found, err := l1.Get(key); !IsValueNotPresentError(err) {
+				t.Errorf("a promoted item should keep its ttl in l1, got '%#v', '%v'", found, err)
+			}
+		}
+	})
+
+	t.Run("GetOrLoad", func(t *testing.T) {
+		l1 := NewCache(nil, nil)
+		l2 := NewCache(nil, nil)
+		myCache := NewTieredCache(l1, l2)
+		defer myCache.Destroy()
+		calls := 0
+		loader := func(context.Context) (interface{}, error) {
+			calls++
+			return "bar", nil
+		}
+		myCache.GetOrLoad(context.Background(), "foo", loader)
+		l1.Clear()
+		if found, err := myCache.GetOrLoad(context.Background(), "foo", loader); err != nil || found != "bar" || calls != 1 {
+			t.Errorf("Cacher.GetOrLoad() expected 'bar' from l2, got '%#v', '%v', %d calls", found, err, calls)
+		}
+	})
+}
@@ -21,6 +21,19 @@ func (t *timedInvalidator) CanCreate(*Metadata, string, interface{}) bool {
 // IsValid compares the most recent of Metadata.Accessed, Metadata.Created, or Metadata.Updated
 // and lifetime.
 func (t *timedInvalidator) IsValid(data *Metadata) bool {
+	return lastUsed(data) >= time.Now().Add(-1*t.lifetime).Unix()
+}
+
+// ExpiresAt is the first moment IsValid returns false, satisfies the
+// ExpiringInvalidator interface.
+func (t *timedInvalidator) ExpiresAt(data *Metadata) (time.Time, bool) {
+	// time stamps are in whole seconds, an item stays valid through the
+	// rest of the second it was last used in.
+	return time.Unix(lastUsed(data)+1, 0).Add(t.lifetime), true
+}
+
+// lastUsed is the most recent of Metadata.Accessed, Metadata.Created, or Metadata.Updated.
+func lastUsed(data *Metadata) int64 {
 	var max int64
 	if data.Created > data.Accessed {
 		max = data.Created
@@ -30,7 +43,7 @@ func (t *timedInvalidator) IsValid(data *Metadata) bool {
 	if data.Modified > max {
 		max = data.Modified
 	}
-	return max >= time.Now().Add(-1*t.lifetime).Unix()
+	return max
 }
 
 func (t *timedInvalidator) AccessExtra(*Metadata) {}
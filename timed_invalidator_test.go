@@ -83,7 +83,26 @@ var testCases = []*struct {
 	},
 }
 
+// testCasesTaken is when testCases took their time stamps.
+var testCasesTaken = time.Now().Unix()
+
+// rebaseTestCases shifts the time stamps of testCases forward by the time
+// since they were taken, the tests running before TestTimedInvalidator
+// outlast its lifetimes.
+func rebaseTestCases() {
+	age := time.Now().Unix() - testCasesTaken
+	for _, tCase := range testCases {
+		for _, stamp := range []*int64{&tCase.tData.Created, &tCase.tData.Accessed, &tCase.tData.Modified} {
+			if *stamp != 0 {
+				*stamp += age
+			}
+		}
+	}
+	testCasesTaken += age
+}
+
 func TestTimedInvalidator(t *testing.T) {
+	rebaseTestCases()
 	for i, tCase := range testCases {
 		dur, _ := time.ParseDuration(tCase.durStr)
 		inv := NewTimedInvalidator(dur)
@@ -111,3 +130,52 @@ func ExampleNewTimedInvalidator() {
 	}
 	// Output: expired
 }
+
+func TestTimedInvalidatorExpiresAt(t *testing.T) {
+	lifetime, _ := time.ParseDuration("1.5s")
+	inv := NewTimedInvalidator(lifetime).(ExpiringInvalidator)
+	data := &Metadata{
+		Created:  time.Now().Unix() - 1,
+		Accessed: time.Now().Unix(),
+		Modified: -1,
+	}
+	at, ok := inv.ExpiresAt(data)
+	if !ok {
+		t.Fatalf("timedInvalidator.ExpiresAt() should always report a deadline")
+	}
+	// IsValid checks against time.Now(), so compare just before and after at
+	time.Sleep(time.Until(at.Add(-100 * time.Millisecond)))
+	if !inv.IsValid(data) {
+		t.Errorf("item should be valid just before %s", at)
+	}
+	time.Sleep(time.Until(at))
+	if inv.IsValid(data) {
+		t.Errorf("item should be invalid at %s", at)
+	}
+}
+
+// deadlineInvalidator never finds an item invalid by polling, only by deadline.
+type deadlineInvalidator struct {
+	NopInvalidator
+	at time.Time
+}
+
+func (d *deadlineInvalidator) ExpiresAt(*Metadata) (time.Time, bool) {
+	return d.at, true
+}
+
+func TestExpiringInvalidator(t *testing.T) {
+	recorder := new(removalRecorder)
+	myCache := NewCache(nil, &deadlineInvalidator{at: time.Now().Add(-time.Second)})
+	defer myCache.Destroy()
+	myCache.OnEvict(recorder.record)
+	myCache.Put("foo", "foo")
+	// the reaper hasn't had a chance to run yet
+	if _, err := myCache.Get("foo"); !IsValueNotPresentError(err) {
+		t.Errorf("an item past its deadline should be a miss, got '%v'", err)
+	}
+	checkRemovals(t, "Get", recorder.take(), removalEvent{"foo", "foo", Invalidated})
+	myCache.Put("bar", "bar")
+	time.Sleep(300 * time.Millisecond)
+	checkRemovals(t, "reaper", recorder.take(), removalEvent{"bar", "bar", Invalidated})
+}
@@ -0,0 +1,176 @@
+package cache
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// WireVersion is the version of the format written by EncodeValue.
+//
+// The format is a version byte followed by a value. A value is a kind byte
+// and a body: the bytes of a []byte, the Codec's encoding of any other value,
+// nothing for nil, or for a cache item its Metadata and then its value.
+// Metadata is Accessed, Created, Modified, Expires, Stale, TTL and
+// StaleWindow as big endian int64s, the length of Extra as a big endian
+// uint32 and the Codec's encoding of Extra, if any. KeyCount is not stored.
+const WireVersion byte = 1
+
+const (
+	// kindRaw is a []byte stored as is.
+	kindRaw byte = iota
+	// kindCodec is any other value encoded with a Codec.
+	kindCodec
+	// kindElement is a cache item, its Metadata followed by its value.
+	kindElement
+	// kindNil is a nil value, with no body.
+	kindNil
+)
+
+// metadataSize is the encoded size of Metadata: Accessed, Created,
+// Modified, Expires, Stale, TTL and StaleWindow followed by the length of
+// Extra.
+const metadataSize = 7*8 + 4
+
+// wireElement is any Element, whatever its value type.
+type wireElement interface {
+	parts() (interface{}, Metadata)
+}
+
+// EncodeValue serializes a value handed to a DataHandler, including the
+// Metadata of cache items, so any DataHandler or TypedDataHandler that
+// stores bytes can use it. []byte values are kept as is, others go through
+// codec.
+func EncodeValue(codec Codec, val interface{}) ([]byte, error) {
+	return encodeValue(codec, []byte{WireVersion}, val)
+}
+
+// DecodeValue is the inverse of EncodeValue, cache items come back as an
+// Element[interface{}] with their Metadata, except KeyCount which the cache
+// fills in on access. Use DecodeElement for the items of a Cache with
+// another value type.
+func DecodeValue(codec Codec, data []byte) (interface{}, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("cannot decode an empty value")
+	}
+	if data[0] != WireVersion {
+		return nil, fmt.Errorf("unsupported wire version %d", data[0])
+	}
+	return decodeValue(codec, data[1:])
+}
+
+// encodeValue appends the encoding of val to buf.
+func encodeValue(codec Codec, buf []byte, val interface{}) ([]byte, error) {
+	switch v := val.(type) {
+	case nil:
+		return append(buf, kindNil), nil
+	case []byte:
+		return append(append(buf, kindRaw), v...), nil
+	case wireElement:
+		data, metadata := v.parts()
+		return encodeElement(codec, buf, data, metadata)
+	default:
+		data, err := codec.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return append(append(buf, kindCodec), data...), nil
+	}
+}
+
+func encodeElement(codec Codec, buf []byte, data interface{}, metadata Metadata) ([]byte, error) {
+	var extra []byte
+	if metadata.Extra != nil {
+		var err error
+		if extra, err = codec.Marshal(metadata.Extra); err != nil {
+			return nil, err
+		}
+	}
+	var header [metadataSize]byte
+	binary.BigEndian.PutUint64(header[0:], uint64(metadata.Accessed))
+	binary.BigEndian.PutUint64(header[8:], uint64(metadata.Created))
+	binary.BigEndian.PutUint64(header[16:], uint64(metadata.Modified))
+	binary.BigEndian.PutUint64(header[24:], uint64(metadata.Expires))
+	binary.BigEndian.PutUint64(header[32:], uint64(metadata.Stale))
+	binary.BigEndian.PutUint64(header[40:], uint64(metadata.TTL))
+	binary.BigEndian.PutUint64(header[48:], uint64(metadata.StaleWindow))
+	binary.BigEndian.PutUint32(header[56:], uint32(len(extra)))
+	buf = append(buf, kindElement)
+	buf = append(buf, header[:]...)
+	buf = append(buf, extra...)
+	return encodeValue(codec, buf, data)
+}
+
+// DecodeElement decodes a cache item written by EncodeValue into an
+// Element[V], for a TypedDataHandler that stores bytes. The value must
+// decode to a V, types other than builtins must be registered with
+// RegisterType.
+func DecodeElement[V any](codec Codec, data []byte) (Element[V], error) {
+	var toRet Element[V]
+	decoded, err := DecodeValue(codec, data)
+	if err != nil {
+		return toRet, err
+	}
+	elem, ok := decoded.(cacheElement)
+	if !ok {
+		return toRet, fmt.Errorf("decoded a %T, not a cache item", decoded)
+	}
+	toRet.metadata = elem.metadata
+	if elem.data == nil {
+		return toRet, nil
+	}
+	if toRet.data, ok = elem.data.(V); !ok {
+		return toRet, fmt.Errorf("decoded a %T, expected a %T", elem.data, toRet.data)
+	}
+	return toRet, nil
+}
+
+func decodeValue(codec Codec, data []byte) (interface{}, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("cannot decode an empty value")
+	}
+	switch data[0] {
+	case kindRaw:
+		return append([]byte(nil), data[1:]...), nil
+	case kindCodec:
+		return codec.Unmarshal(data[1:])
+	case kindElement:
+		return decodeElement(codec, data[1:])
+	case kindNil:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown value kind %d", data[0])
+	}
+}
+
+func decodeElement(codec Codec, data []byte) (cacheElement, error) {
+	var toRet cacheElement
+	if len(data) < metadataSize {
+		return toRet, fmt.Errorf("element too short, %d bytes", len(data))
+	}
+	toRet.metadata.Accessed = int64(binary.BigEndian.Uint64(data))
+	toRet.metadata.Created = int64(binary.BigEndian.Uint64(data[8:]))
+	toRet.metadata.Modified = int64(binary.BigEndian.Uint64(data[16:]))
+	toRet.metadata.Expires = int64(binary.BigEndian.Uint64(data[24:]))
+	toRet.metadata.Stale = int64(binary.BigEndian.Uint64(data[32:]))
+	toRet.metadata.TTL = time.Duration(binary.BigEndian.Uint64(data[40:]))
+	toRet.metadata.StaleWindow = time.Duration(binary.BigEndian.Uint64(data[48:]))
+	extraLen := int(binary.BigEndian.Uint32(data[56:]))
+	data = data[metadataSize:]
+	if len(data) < extraLen {
+		return toRet, fmt.Errorf("element too short for %d bytes of Extra", extraLen)
+	}
+	if extraLen > 0 {
+		extra, err := codec.Unmarshal(data[:extraLen])
+		if err != nil {
+			return toRet, err
+		}
+		toRet.metadata.Extra = extra
+	}
+	val, err := decodeValue(codec, data[extraLen:])
+	if err != nil {
+		return toRet, err
+	}
+	toRet.data = val
+	return toRet, nil
+}
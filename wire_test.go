@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWire(t *testing.T) {
+	elem := cacheElement{
+		data: codecPoint{1, 2},
+		metadata: Metadata{
+			Accessed:    1,
+			Created:     2,
+			Modified:    3,
+			Expires:     4,
+			Stale:       5,
+			TTL:         6,
+			StaleWindow: 7,
+			Extra:       "extra",
+		},
+	}
+	values := []interface{}{
+		nil, "foo", []byte("bar"), elem,
+		cacheElement{data: []byte("bar")},
+		cacheElement{},
+	}
+	for _, codec := range []Codec{GobCodec{}, JSONCodec{}} {
+		name := reflect.TypeOf(codec).Name()
+		t.Run(name, func(t *testing.T) {
+			for _, val := range values {
+				data, err := EncodeValue(codec, val)
+				if err != nil {
+					t.Errorf("EncodeValue(%#v) returned an error, %v", val, err)
+					continue
+				}
+				if data[0] != WireVersion {
+					t.Errorf("EncodeValue() expected version %d, got %d", WireVersion, data[0])
+				}
+				found, err := DecodeValue(codec, data)
+				if err != nil || !reflect.DeepEqual(found, val) {
+					t.Errorf("DecodeValue() expected '%#v', got '%#v', '%v'", val, found, err)
+				}
+			}
+		})
+	}
+
+	data, _ := EncodeValue(GobCodec{}, elem)
+	data[0] = WireVersion + 1
+	if _, err := DecodeValue(GobCodec{}, data); err == nil {
+		t.Errorf("DecodeValue() should have rejected an unknown version")
+	}
+	data[0] = WireVersion
+	if _, err := DecodeValue(GobCodec{}, data[:10]); err == nil {
+		t.Errorf("DecodeValue() should have rejected a truncated element")
+	}
+}
+
+// bytesHandler stores the Elements of a typed Cache as bytes.
+type bytesHandler[V any] struct {
+	TypedDataHandler[string, []byte]
+	codec Codec
+}
+
+func (b bytesHandler[V]) Put(key string, elem Element[V]) error {
+	data, err := EncodeValue(b.codec, elem)
+	if err != nil {
+		return err
+	}
+	return b.TypedDataHandler.Put(key, data)
+}
+
+func (b bytesHandler[V]) Get(key string) (Element[V], error) {
+	data, err := b.TypedDataHandler.Get(key)
+	if err != nil {
+		return Element[V]{}, err
+	}
+	return DecodeElement[V](b.codec, data)
+}
+
+func (b bytesHandler[V]) Range(f func(string, Element[V]) bool) {
+	b.TypedDataHandler.Range(func(key string, data []byte) bool {
+		elem, err := DecodeElement[V](b.codec, data)
+		return err != nil || f(key, elem)
+	})
+}
+
+func TestTypedWire(t *testing.T) {
+	for _, codec := range []Codec{GobCodec{}, JSONCodec{}} {
+		name := reflect.TypeOf(codec).Name()
+		t.Run(name, func(t *testing.T) {
+			elem := NewElement(codecPoint{1, 2}, Metadata{Created: 2, Expires: 4, TTL: 6})
+			data, err := EncodeValue(codec, elem)
+			if err != nil {
+				t.Fatalf("EncodeValue() returned an error, %v", err)
+			}
+			found, err := DecodeElement[codecPoint](codec, data)
+			if err != nil || !reflect.DeepEqual(found, elem) {
+				t.Errorf("DecodeElement() expected '%#v', got '%#v', '%v'", elem, found, err)
+			}
+			if _, err := DecodeElement[string](codec, data); err == nil {
+				t.Errorf("DecodeElement() should have rejected a value of the wrong type")
+			}
+
+			handler := bytesHandler[codecPoint]{
+				TypedDataHandler: NewTypedInMemoryDataHandler[string, []byte](),
+				codec:            codec,
+			}
+			myCache := NewTypedCache[string, codecPoint](handler, nil)
+			defer myCache.Destroy()
+			myCache.PutWithTTL("foo", codecPoint{3, 4}, time.Hour)
+			if found, err := myCache.Get("foo"); err != nil || found != (codecPoint{3, 4}) {
+				t.Errorf("Cache.Get() expected '%#v', got '%#v', '%v'", codecPoint{3, 4}, found, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,289 @@
+package cache
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// WriteBehindDataHandler is a DataHandler that queues writes in memory and
+// writes them to the DataHandler it wraps later.
+type WriteBehindDataHandler interface {
+	DataHandler
+	// Flush writes every queued write, writes that fail stay queued unless
+	// a newer one for the same key replaced them.
+	Flush(context.Context) error
+	// Close stops the background flushes, flushes what is left and closes
+	// the wrapped DataHandler if it is an io.Closer. Cache.Destroy calls it.
+	Close() error
+	// Persistent reports whether the wrapped DataHandler is a
+	// PersistentDataHandler keeping its items across Close.
+	Persistent() bool
+}
+
+// NewWriteBehindDataHandler returns a DataHandler that queues Put and Remove
+// calls in memory and writes them to dataHandler every interval, or sooner
+// once maxPending keys are queued. Repeated writes to a key are coalesced and
+// Get sees queued writes. A BatchDataHandler gets one PutMany and one
+// RemoveMany per flush. interval <= 0 defaults to a second, maxPending <= 0
+// means no size threshold.
+func NewWriteBehindDataHandler(dataHandler DataHandler, interval time.Duration, maxPending int) WriteBehindDataHandler {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	toRet := &writeBehind{
+		dataHandler: dataHandler,
+		ctxHandler:  contextHandler[string, interface{}](dataHandler),
+		maxPending:  maxPending,
+		pending:     make(map[string]pendingWrite),
+		full:        make(chan struct{}, 1),
+		quit:        make(chan struct{}),
+	}
+	toRet.batch, _ = dataHandler.(BatchDataHandler)
+	toRet.background.Add(1)
+	go toRet.begin(interval)
+	return toRet
+}
+
+type pendingWrite struct {
+	val    interface{}
+	remove bool
+}
+
+type writeBehind struct {
+	dataHandler DataHandler
+	ctxHandler  TypedContextDataHandler[string, interface{}]
+	// batch is nil unless dataHandler is a BatchDataHandler
+	batch      BatchDataHandler
+	maxPending int
+	sync.Mutex
+	pending map[string]pendingWrite
+	// inflight is what the running flush is writing
+	inflight   map[string]pendingWrite
+	flushing   sync.Mutex
+	full       chan struct{}
+	quit       chan struct{}
+	closing    sync.Once
+	background sync.WaitGroup
+}
+
+func (w *writeBehind) begin(interval time.Duration) {
+	defer w.background.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.quit:
+			return
+		case <-ticker.C:
+		case <-w.full:
+		}
+		// failed writes stay queued for the next flush
+		w.Flush(context.Background())
+	}
+}
+
+// queued returns the latest queued write for key, the lock must be held.
+func (w *writeBehind) queued(key string) (pendingWrite, bool) {
+	if p, ok := w.pending[key]; ok {
+		return p, true
+	}
+	p, ok := w.inflight[key]
+	return p, ok
+}
+
+func (w *writeBehind) enqueue(key string, p pendingWrite) {
+	w.Lock()
+	w.pending[key] = p
+	count := len(w.pending)
+	w.Unlock()
+	if w.maxPending > 0 && count >= w.maxPending {
+		select {
+		case w.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (w *writeBehind) Put(key string, data interface{}) error {
+	w.enqueue(key, pendingWrite{val: data})
+	return nil
+}
+
+func (w *writeBehind) Get(key string) (interface{}, error) {
+	w.Lock()
+	p, ok := w.queued(key)
+	w.Unlock()
+	if !ok {
+		return w.dataHandler.Get(key)
+	}
+	if p.remove {
+		return nil, ValueNotPresentError{
+			Key: key,
+		}
+	}
+	return p.val, nil
+}
+
+// Remove queues the removal, checking the wrapped DataHandler for the item
+// unless a write for it is queued.
+func (w *writeBehind) Remove(key string) error {
+	w.Lock()
+	p, ok := w.queued(key)
+	w.Unlock()
+	if ok && p.remove {
+		return ValueNotPresentError{
+			Key: key,
+		}
+	}
+	if !ok {
+		if _, err := w.dataHandler.Get(key); err != nil {
+			return err
+		}
+	}
+	w.enqueue(key, pendingWrite{remove: true})
+	return nil
+}
+
+// Clear drops every queued write and clears the wrapped DataHandler.
+func (w *writeBehind) Clear() error {
+	w.flushing.Lock()
+	defer w.flushing.Unlock()
+	w.Lock()
+	w.pending = make(map[string]pendingWrite)
+	w.Unlock()
+	return w.dataHandler.Clear()
+}
+
+// Range calls f with the queued items first, then those in the wrapped
+// DataHandler without a queued write.
+func (w *writeBehind) Range(f func(string, interface{}) bool) {
+	w.Lock()
+	queued := make(map[string]pendingWrite, len(w.pending)+len(w.inflight))
+	for key, p := range w.inflight {
+		queued[key] = p
+	}
+	for key, p := range w.pending {
+		queued[key] = p
+	}
+	w.Unlock()
+	for key, p := range queued {
+		if !p.remove && !f(key, p.val) {
+			return
+		}
+	}
+	w.dataHandler.Range(func(key string, val interface{}) bool {
+		if _, ok := queued[key]; ok {
+			return true
+		}
+		return f(key, val)
+	})
+}
+
+func (w *writeBehind) Flush(ctx context.Context) error {
+	w.flushing.Lock()
+	defer w.flushing.Unlock()
+	w.Lock()
+	w.inflight = w.pending
+	w.pending = make(map[string]pendingWrite)
+	writes := w.inflight
+	w.Unlock()
+	if len(writes) == 0 {
+		return nil
+	}
+	err := w.write(ctx, writes)
+	w.Lock()
+	defer w.Unlock()
+	for key, p := range w.inflight {
+		if _, ok := w.pending[key]; !ok {
+			w.pending[key] = p
+		}
+	}
+	w.inflight = nil
+	return err
+}
+
+// write writes writes to the wrapped DataHandler, dropping each from
+// inflight once it is written.
+func (w *writeBehind) write(ctx context.Context, writes map[string]pendingWrite) error {
+	if w.batch != nil {
+		puts := make(map[string]interface{})
+		var removes []string
+		for key, p := range writes {
+			if p.remove {
+				removes = append(removes, key)
+			} else {
+				puts[key] = p.val
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := w.batch.PutMany(puts); err != nil {
+			return err
+		}
+		w.written(puts)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := w.batch.RemoveMany(removes); err != nil {
+			return err
+		}
+		w.Lock()
+		w.inflight = nil
+		w.Unlock()
+		return nil
+	}
+	keys := make([]string, 0, len(writes))
+	for key := range writes {
+		keys = append(keys, key)
+	}
+	for _, key := range keys {
+		var err error
+		if p := writes[key]; p.remove {
+			err = w.ctxHandler.RemoveContext(ctx, key)
+			if IsValueNotPresentError(err) {
+				err = nil
+			}
+		} else {
+			err = w.ctxHandler.PutContext(ctx, key, p.val)
+		}
+		if err != nil {
+			return err
+		}
+		w.Lock()
+		delete(w.inflight, key)
+		w.Unlock()
+	}
+	return nil
+}
+
+// written drops the keys in puts from inflight.
+func (w *writeBehind) written(puts map[string]interface{}) {
+	w.Lock()
+	defer w.Unlock()
+	for key := range puts {
+		delete(w.inflight, key)
+	}
+}
+
+// Persistent reports whether the wrapped DataHandler is persistent.
+func (w *writeBehind) Persistent() bool {
+	return persistent(w.dataHandler)
+}
+
+func (w *writeBehind) Close() error {
+	var err error
+	w.closing.Do(func() {
+		close(w.quit)
+		w.background.Wait()
+		err = w.Flush(context.Background())
+		if closer, ok := w.dataHandler.(io.Closer); ok {
+			if cerr := closer.Close(); err == nil {
+				err = cerr
+			}
+		}
+	})
+	return err
+}
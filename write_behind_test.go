@@ -0,0 +1,142 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// failingHandler fails every Put while fail is set.
+type failingHandler struct {
+	DataHandler
+	fail bool
+}
+
+func (f *failingHandler) Put(key string, val interface{}) error {
+	if f.fail {
+		return errors.New("backend down")
+	}
+	return f.DataHandler.Put(key, val)
+}
+
+func TestWriteBehindDataHandler(t *testing.T) {
+	t.Run("Flush", func(t *testing.T) {
+		inner := NewInMemoryDataHandler()
+		handler := NewWriteBehindDataHandler(inner, time.Hour, 0)
+		myCache := NewCache(handler, nil)
+		defer myCache.Destroy()
+		for i := 0; i < 3; i++ {
+			myCache.Put("foo", i)
+		}
+		if found, err := myCache.Get("foo"); err != nil || found != 2 {
+			t.Errorf("Cacher.Get() expected %d, got '%#v', '%v'", 2, found, err)
+		}
+		if _, err := inner.Get("foo"); !IsValueNotPresentError(err) {
+			t.Errorf("Put() should not have reached the wrapped handler yet, got '%v'", err)
+		}
+		if err := handler.Flush(context.Background()); err != nil {
+			t.Fatalf("Flush() returned an error, %v", err)
+		}
+		if found, err := inner.Get("foo"); err != nil || found.(cacheElement).Value() != 2 {
+			t.Errorf("Flush() expected %d in the wrapped handler, got '%#v', '%v'", 2, found, err)
+		}
+		myCache.Remove("foo")
+		if _, err := myCache.Get("foo"); !IsValueNotPresentError(err) {
+			t.Errorf("Cacher.Get() should have returned a ValueNotPresentError, got '%v'", err)
+		}
+		if err := handler.Remove("foo"); !IsValueNotPresentError(err) {
+			t.Errorf("Remove() should have returned a ValueNotPresentError, got '%v'", err)
+		}
+		handler.Flush(context.Background())
+		if _, err := inner.Get("foo"); !IsValueNotPresentError(err) {
+			t.Errorf("Flush() should have removed foo, got '%v'", err)
+		}
+	})
+
+	t.Run("maxPending", func(t *testing.T) {
+		inner := NewShardedDataHandler(1)
+		handler := NewWriteBehindDataHandler(inner, time.Hour, 2)
+		defer handler.Close()
+		handler.Put("foo", 1)
+		handler.Put("bar", 2)
+		deadline := time.Now().Add(time.Second)
+		for inner.Len() != 2 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		if inner.Len() != 2 {
+			t.Errorf("reaching maxPending should have flushed, %d items written", inner.Len())
+		}
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		inner := &countingBatchHandler{DataHandler: NewInMemoryDataHandler()}
+		inner.Put("bar", 1)
+		handler := NewWriteBehindDataHandler(inner, time.Hour, 0)
+		defer handler.Close()
+		handler.Put("foo", 1)
+		handler.Remove("bar")
+		handler.Flush(context.Background())
+		if inner.batchCalls != 2 {
+			t.Errorf("Flush() expected %d batch calls, got %d", 2, inner.batchCalls)
+		}
+		if _, err := inner.Get("bar"); !IsValueNotPresentError(err) {
+			t.Errorf("Flush() should have removed bar, got '%v'", err)
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		inner := &failingHandler{DataHandler: NewInMemoryDataHandler(), fail: true}
+		handler := NewWriteBehindDataHandler(inner, time.Hour, 0)
+		defer handler.Close()
+		handler.Put("foo", 1)
+		if err := handler.Flush(context.Background()); err == nil {
+			t.Errorf("Flush() should have returned the wrapped handler's error")
+		}
+		if found, err := handler.Get("foo"); err != nil || found != 1 {
+			t.Errorf("Get() expected the failed write to stay queued, got '%#v', '%v'", found, err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		inner.fail = false
+		if err := handler.Flush(ctx); !errors.Is(err, context.Canceled) {
+			t.Errorf("Flush() expected a cancelled context, got '%v'", err)
+		}
+		handler.Flush(context.Background())
+		if found, err := inner.Get("foo"); err != nil || found != 1 {
+			t.Errorf("Flush() expected %d in the wrapped handler, got '%#v', '%v'", 1, found, err)
+		}
+	})
+
+	t.Run("Destroy", func(t *testing.T) {
+		inner := NewInMemoryDataHandler()
+		myCache := NewCache(NewWriteBehindDataHandler(inner, time.Hour, 0), nil)
+		recorder := new(removalRecorder)
+		myCache.OnEvict(recorder.record)
+		myCache.Put("foo", "bar")
+		myCache.Destroy()
+		checkRemovals(t, "Destroy", recorder.take(), removalEvent{"foo", "bar", Cleared})
+		if _, err := inner.Get("foo"); !IsValueNotPresentError(err) {
+			t.Errorf("Cacher.Destroy() should have cleared a handler that isn't persistent, got '%v'", err)
+		}
+	})
+
+	t.Run("DestroyPersistent", func(t *testing.T) {
+		dir := t.TempDir()
+		inner, err := NewLogDataHandler(dir, nil, 0)
+		if err != nil {
+			t.Fatalf("NewLogDataHandler() returned an error, %v", err)
+		}
+		myCache := NewCache(NewWriteBehindDataHandler(inner, time.Hour, 0), nil)
+		myCache.Put("foo", "bar")
+		myCache.Destroy()
+		inner, err = NewLogDataHandler(dir, nil, 0)
+		if err != nil {
+			t.Fatalf("NewLogDataHandler() returned an error, %v", err)
+		}
+		defer inner.Close()
+		if found, err := inner.Get("foo"); err != nil || found.(cacheElement).Value() != "bar" {
+			t.Errorf("Cacher.Destroy() should have flushed foo, got '%#v', '%v'", found, err)
+		}
+	})
+}